@@ -1,26 +1,30 @@
 package main
 
 import (
+	"os"
+
 	"github.com/chatmail/rpc-client-go/v2/deltachat"
 	"github.com/deltachat-bot/deltabot-cli-go/v2/botcli"
 	"github.com/spf13/cobra"
+	"go.uber.org/zap"
 )
 
 func main() {
 	cli := botcli.New("echobot")
 
-	cli.OnBotInit(func(cli *botcli.BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string) {
-		// incoming message handling
-		bot.OnNewMsg(func(bot *deltachat.Bot, accId uint32, msgId uint32) {
-			msg, _ := bot.Rpc.GetMessage(accId, msgId)
-			if msg.FromId > deltachat.ContactLastSpecial && msg.Text != "" {
-				_, _ = bot.Rpc.SendMsg(accId, msg.ChatId, deltachat.MessageData{Text: &msg.Text})
+	// incoming message handling
+	cli.OnNewMsg(func(cli *botcli.BotCli, bot *deltachat.Bot, accId uint32, msg *deltachat.Message, logger *zap.SugaredLogger) {
+		if msg.FromId > deltachat.ContactLastSpecial && msg.Text != "" {
+			if _, err := bot.Rpc.SendMsg(accId, msg.ChatId, deltachat.MessageData{Text: &msg.Text}); err != nil {
+				logger.Error(err)
 			}
-		})
+		}
 	})
 	cli.OnBotStart(func(cli *botcli.BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string) {
 		cli.Logger.Info("OnBotStart event triggered: bot is about to start!")
 	})
 
-	_ = cli.Start()
+	if err := cli.Start(); err != nil {
+		os.Exit(1)
+	}
 }
@@ -6,6 +6,7 @@ require (
 	github.com/chatmail/rpc-client-go/v2 v2.49.0
 	github.com/deltachat-bot/deltabot-cli-go/v2 v2.49.0
 	github.com/spf13/cobra v1.10.2
+	go.uber.org/zap v1.26.0
 )
 
 require (
@@ -14,6 +15,5 @@ require (
 	github.com/inconshreveable/mousetrap v1.1.0 // indirect
 	github.com/spf13/pflag v1.0.9 // indirect
 	go.uber.org/multierr v1.11.0 // indirect
-	go.uber.org/zap v1.26.0 // indirect
 	golang.org/x/sync v0.19.0 // indirect
 )
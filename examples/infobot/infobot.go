@@ -6,6 +6,7 @@ package main
 
 import (
 	"fmt"
+	"os"
 
 	"github.com/chatmail/rpc-client-go/v2/deltachat"
 	"github.com/deltachat-bot/deltabot-cli-go/v2/botcli"
@@ -14,24 +15,15 @@ import (
 
 var cli *botcli.BotCli = botcli.New("infobot")
 
-// Process messages sent by administrators.
-func onNewMsg(bot *deltachat.Bot, accId uint32, msgId uint32) {
-	msg, _ := bot.Rpc.GetMessage(accId, msgId)
-	if msg.FromId <= deltachat.ContactLastSpecial { // ignore message from self
-		return
+// Process the /info command, only bot administrators are allowed to use it.
+func onInfoCmd(cli *botcli.BotCli, bot *deltachat.Bot, req *botcli.ChatRequest) {
+	info, _ := bot.Rpc.GetInfo(req.AccId)
+	var text string
+	for key, value := range info {
+		text += key + "=" + value + "\n"
 	}
-
-	isAdmin, _ := cli.IsAdmin(bot, accId, msg.FromId)
-	if isAdmin {
-		switch msg.Text {
-		case "/info":
-			info, _ := bot.Rpc.GetInfo(accId)
-			var text string
-			for key, value := range info {
-				text += key + "=" + value + "\n"
-			}
-			_, _ = bot.Rpc.SendMsg(accId, msg.ChatId, deltachat.MessageData{Text: &text})
-		}
+	if err := req.Reply(bot, text); err != nil {
+		req.Logger.Error(err)
 	}
 }
 
@@ -42,20 +34,25 @@ func main() {
 		Short: "display information about the Delta Chat core running in this system or about an specific account if one was selected with -a/--account",
 		Args:  cobra.ExactArgs(0),
 	}
-	cli.AddCommand(infoCmd, func(cli *botcli.BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string) {
+	cli.AddCommandE(infoCmd, func(cli *botcli.BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string) error {
 		var info map[string]string
+		var err error
 		if cli.SelectedAccount == 0 { // no account selected with --a/--account, show system info
-			info, _ = bot.Rpc.GetSystemInfo()
+			info, err = bot.Rpc.GetSystemInfo()
 		} else { // account selected, show info about that account
-			info, _ = bot.Rpc.GetInfo(cli.SelectedAccount)
+			info, err = bot.Rpc.GetInfo(cli.SelectedAccount)
+		}
+		if err != nil {
+			return err
 		}
 		for key, val := range info {
-			fmt.Printf("%v=%#v\n", key, val)
+			fmt.Fprintf(cmd.OutOrStdout(), "%v=%#v\n", key, val)
 		}
+		return nil
 	})
 
-	cli.OnBotInit(func(cli *botcli.BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string) {
-		bot.OnNewMsg(onNewMsg)
-	})
-	_ = cli.Start()
+	cli.AddChatCommand("info", "display information about the bot account", onInfoCmd).Role = botcli.RoleAdmin
+	if err := cli.Start(); err != nil {
+		os.Exit(1)
+	}
 }
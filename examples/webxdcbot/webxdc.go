@@ -16,20 +16,22 @@ in thecurrent working dir.
 package main
 
 import (
+	"os"
+
 	"github.com/chatmail/rpc-client-go/v2/deltachat"
 	"github.com/deltachat-bot/deltabot-cli-go/v2/botcli"
 	"github.com/deltachat-bot/deltabot-cli-go/v2/xdcrpc"
-	"github.com/spf13/cobra"
+	"go.uber.org/zap"
 )
 
 var cli = botcli.New("webxdcbot")
 
 func main() {
-	cli.OnBotInit(func(cli *botcli.BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string) {
-		bot.OnUnhandledEvent(onEvent)
-		bot.OnNewMsg(onNewMsg)
-	})
-	_ = cli.Start()
+	cli.OnUnhandledEvent(onEvent)
+	cli.OnNewMsg(onNewMsg)
+	if err := cli.Start(); err != nil {
+		os.Exit(1)
+	}
 }
 
 func onEvent(bot *deltachat.Bot, accId uint32, event deltachat.EventType) {
@@ -39,9 +41,7 @@ func onEvent(bot *deltachat.Bot, accId uint32, event deltachat.EventType) {
 	}
 }
 
-func onNewMsg(bot *deltachat.Bot, accId uint32, msgId uint32) {
-	msg, _ := bot.Rpc.GetMessage(accId, msgId)
-	logger := cli.GetLogger(accId).With("chat", msg.ChatId)
+func onNewMsg(cli *botcli.BotCli, bot *deltachat.Bot, accId uint32, msg *deltachat.Message, logger *zap.SugaredLogger) {
 	if msg.FromId > deltachat.ContactLastSpecial {
 		logger.Info("message received, sending the mini-app")
 		file := "app.xdc"
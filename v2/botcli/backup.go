@@ -0,0 +1,293 @@
+package botcli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/chatmail/rpc-client-go/v2/deltachat"
+	"github.com/spf13/cobra"
+)
+
+// Layout of the timestamp included in the name of the backup files.
+const backupTimeLayout = "20060102-150405"
+
+func exportCallback(cli *BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string) error {
+	passphrase, err := readPassphrase(cmd)
+	if err != nil {
+		return err
+	}
+	accounts, err := selectedAccounts(cli, bot)
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(args[0], 0750); err != nil {
+		return err
+	}
+
+	outputs, err := forEachAccount(accounts, func(out *accountOutput) error {
+		if out.Configured, _ = bot.Rpc.IsConfigured(out.Id); !out.Configured {
+			return &AccountNotConfiguredErr{AccId: out.Id}
+		}
+		path, err := cli.exportBackup(bot, out.Id, args[0], passphrase)
+		if err != nil {
+			return fmt.Errorf("backup failed: %w", err)
+		}
+		out.Backup = path
+		out.text = append(out.text, "Backup saved to "+path)
+		return nil
+	})
+	return errors.Join(printOutputs(cli, cmd, outputs, true), err)
+}
+
+func importCallback(cli *BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string) error {
+	if cli.SelectedAccount != 0 {
+		return errSingleAccount
+	}
+	passphrase, err := readPassphrase(cmd)
+	if err != nil {
+		return err
+	}
+
+	var outputs []*accountOutput
+	var errs []error
+	for _, path := range args {
+		out := &accountOutput{Backup: path}
+		if err := importForAcc(cli, bot, path, passphrase, out); err != nil {
+			out.Error = err.Error()
+			errs = append(errs, err)
+		}
+		outputs = append(outputs, out)
+	}
+	return errors.Join(printOutputs(cli, cmd, outputs, false), errors.Join(errs...))
+}
+
+// Restore the given backup file as a new account.
+func importForAcc(cli *BotCli, bot *deltachat.Bot, path string, passphrase *string, out *accountOutput) error {
+	accId, err := bot.Rpc.AddAccount()
+	if err != nil {
+		return err
+	}
+	out.Id = accId
+	if err := bot.Rpc.ImportBackup(accId, path, passphrase); err != nil {
+		if err := bot.Rpc.RemoveAccount(accId); err != nil {
+			cli.GetLogger(accId).Errorf("Failed to remove account after failed import: %v", err)
+		}
+		out.Id = 0
+		return fmt.Errorf("failed to import %v: %w", path, err)
+	}
+	cli.GetLogger(accId).Infof("Backup %v imported successfully.", path)
+	if err := listForAcc(cli, bot, out); err != nil {
+		return err
+	}
+	out.text[len(out.text)-1] += " (imported from " + path + ")"
+	return nil
+}
+
+// Export a backup of the given account to the given directory, returns the path of the created tar file.
+// The file is named after the app name, the account ID and the current time, existing files are not overwritten.
+func (botcli *BotCli) exportBackup(bot *deltachat.Bot, accId uint32, dir string, passphrase *string) (string, error) {
+	// the core chooses the file name, export to a temporary folder and then rename the file
+	tmpDir, err := os.MkdirTemp(dir, ".export-")
+	if err != nil {
+		return "", err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	if err := bot.Rpc.ExportBackup(accId, tmpDir, passphrase); err != nil {
+		return "", err
+	}
+	files, err := filepath.Glob(filepath.Join(tmpDir, "*.tar"))
+	if err != nil {
+		return "", err
+	}
+	if len(files) != 1 {
+		return "", fmt.Errorf("expected one backup file, found %v", len(files))
+	}
+
+	name := fmt.Sprintf("%v-account%v-%v.tar", botcli.AppName, accId, time.Now().Format(backupTimeLayout))
+	path := filepath.Join(dir, name)
+	// unlike renaming, linking fails instead of replacing a backup saved in the same second
+	if err := os.Link(files[0], path); errors.Is(err, os.ErrExist) {
+		return "", fmt.Errorf("backup file %v already exists", path)
+	} else if err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// Start saving backups of all configured accounts to the given folder every interval, keeping only
+// the given number of most recent backups of each account, or all of them if keep is zero.
+// The first backup is saved when it is due according to the existing backups, see nextBackupDelay().
+// Returns a function to stop the scheduled backups.
+func (botcli *BotCli) startBackups(bot *deltachat.Bot, dir string, interval time.Duration, keep int, passphrase *string) (func(), error) {
+	if interval <= 0 {
+		return nil, errors.New("the backup interval must be greater than zero")
+	}
+	if keep < 0 {
+		return nil, errors.New("the number of backups to keep can't be negative")
+	}
+	if err := os.MkdirAll(dir, 0750); err != nil {
+		return nil, err
+	}
+
+	botcli.Logger.Infof("Saving backups to %v every %v", dir, interval)
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		timer := time.NewTimer(botcli.nextBackupDelay(bot, dir, interval))
+		defer timer.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case <-timer.C:
+				botcli.backupAll(bot, dir, keep, passphrase)
+				timer.Reset(interval)
+			}
+		}
+	}()
+	return func() {
+		cancel()
+		<-done
+	}, nil
+}
+
+// Get how long to wait for the next scheduled backup, based on the newest backup of each configured
+// account in the given folder, so restarting the bot doesn't delay or repeat the backups.
+func (botcli *BotCli) nextBackupDelay(bot *deltachat.Bot, dir string, interval time.Duration) time.Duration {
+	accounts, err := bot.Rpc.GetAllAccountIds()
+	if err != nil {
+		return 0
+	}
+	delay := interval
+	for _, accId := range accounts {
+		if isConf, _ := bot.Rpc.IsConfigured(accId); !isConf {
+			continue
+		}
+		files, err := botcli.backupFiles(accId, dir)
+		if err != nil || len(files) == 0 {
+			return 0
+		}
+		saved, err := backupTime(files[len(files)-1])
+		if err != nil {
+			return 0
+		}
+		delay = min(delay, max(time.Until(saved.Add(interval)), 0))
+	}
+	return delay
+}
+
+// Save a backup of each configured account and prune the old backups, errors are reported to the admin chat.
+func (botcli *BotCli) backupAll(bot *deltachat.Bot, dir string, keep int, passphrase *string) {
+	accounts, err := bot.Rpc.GetAllAccountIds()
+	if err != nil {
+		botcli.Logger.Errorf("Scheduled backup failed: %v", err)
+		return
+	}
+	for _, accId := range accounts {
+		if isConf, _ := bot.Rpc.IsConfigured(accId); !isConf {
+			continue
+		}
+		path, err := botcli.exportBackup(bot, accId, dir, passphrase)
+		if err != nil {
+			botcli.reportBackupErr(bot, accId, err)
+			continue
+		}
+		botcli.GetLogger(accId).Infof("Backup saved to %v", path)
+		if keep == 0 {
+			continue
+		}
+		if err := botcli.pruneBackups(accId, dir, keep); err != nil {
+			botcli.reportBackupErr(bot, accId, fmt.Errorf("failed to remove old backups: %w", err))
+		}
+	}
+}
+
+// Get the backup files of the given account in the given folder, from the oldest to the newest.
+func (botcli *BotCli) backupFiles(accId uint32, dir string) ([]string, error) {
+	files, err := filepath.Glob(filepath.Join(dir, fmt.Sprintf("%v-account%v-*.tar", botcli.AppName, accId)))
+	sort.Strings(files) // the timestamps in the names sort chronologically
+	return files, err
+}
+
+// Get the time a backup file was saved from its name.
+func backupTime(path string) (time.Time, error) {
+	name := strings.TrimSuffix(filepath.Base(path), ".tar")
+	if len(name) < len(backupTimeLayout) {
+		return time.Time{}, fmt.Errorf("invalid backup file name %v", path)
+	}
+	return time.ParseInLocation(backupTimeLayout, name[len(name)-len(backupTimeLayout):], time.Local)
+}
+
+// Remove the oldest backups of the given account in the given folder, keeping only the given number of backups.
+func (botcli *BotCli) pruneBackups(accId uint32, dir string, keep int) error {
+	files, err := botcli.backupFiles(accId, dir)
+	if err != nil || len(files) <= keep {
+		return err
+	}
+	var errs []error
+	for _, file := range files[:len(files)-keep] {
+		if err := os.Remove(file); err != nil {
+			errs = append(errs, err)
+		} else {
+			botcli.GetLogger(accId).Debugf("Old backup %v removed", file)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Log the given scheduled backup error and report it to the admin chat of the given account.
+func (botcli *BotCli) reportBackupErr(bot *deltachat.Bot, accId uint32, backupErr error) {
+	logger := botcli.GetLogger(accId)
+	logger.Errorf("Scheduled backup failed: %v", backupErr)
+	chatId, err := botcli.AdminChat(bot, accId)
+	if err == nil {
+		text := fmt.Sprintf("Scheduled backup failed: %v", backupErr)
+		_, err = bot.Rpc.SendMsg(accId, chatId, deltachat.MessageData{Text: &text})
+	}
+	if err != nil {
+		logger.Errorf("Failed to report backup error to the admin chat: %v", err)
+	}
+}
+
+// Get the backup passphrase given with the --passphrase-file or --passphrase-env options, nil if none was given.
+func readPassphrase(cmd *cobra.Command) (*string, error) {
+	file, _ := cmd.Flags().GetString("passphrase-file")
+	envVar, _ := cmd.Flags().GetString("passphrase-env")
+	if file != "" && envVar != "" {
+		return nil, errors.New("the --passphrase-file and --passphrase-env options can't be used together")
+	}
+
+	var passphrase string
+	if file != "" {
+		data, err := os.ReadFile(file)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read passphrase: %w", err)
+		}
+		passphrase = strings.TrimRight(string(data), "\r\n")
+	} else if envVar != "" {
+		var ok bool
+		if passphrase, ok = os.LookupEnv(envVar); !ok {
+			return nil, fmt.Errorf("environment variable %v is not set", envVar)
+		}
+	} else {
+		return nil, nil
+	}
+	if passphrase == "" {
+		return nil, errors.New("the backup passphrase is empty")
+	}
+	return &passphrase, nil
+}
+
+// Add the --passphrase-file and --passphrase-env options to the given backup subcommand.
+func addPassphraseFlags(cmd *cobra.Command, usage string) {
+	cmd.Flags().String("passphrase-file", "", usage+" read from this file")
+	cmd.Flags().String("passphrase-env", "", usage+" read from this environment variable")
+}
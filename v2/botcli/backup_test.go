@@ -0,0 +1,134 @@
+package botcli_test
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/deltachat-bot/deltabot-cli-go/v2/botcli"
+	"github.com/deltachat-bot/deltabot-cli-go/v2/botcli/bottest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestExportImport(t *testing.T) {
+	fake := bottest.New()
+	fake.AddAccount("bot@example.org")
+	dir := t.TempDir()
+	backupDir := filepath.Join(dir, "backups")
+	passFile := filepath.Join(dir, "passphrase")
+	require.Nil(t, os.WriteFile(passFile, []byte("secret\n"), 0600))
+
+	result := runFake(t, fake, "--log-level=error", "--output=json", "export", "--passphrase-file="+passFile, backupDir)
+	require.Nil(t, result.Err)
+	var outputs []struct {
+		Id        uint32
+		Backup    string
+		Addresses []string
+	}
+	require.Nil(t, json.Unmarshal([]byte(result.Stdout), &outputs))
+	require.Len(t, outputs, 1)
+	require.Equal(t, backupDir, filepath.Dir(outputs[0].Backup))
+	require.Regexp(t, `^testbot-account1-\d{8}-\d{6}\.tar$`, filepath.Base(outputs[0].Backup))
+	backup := outputs[0].Backup
+
+	result = runFake(t, fake, "--log-level=error", "import", backup)
+	require.NotNil(t, result.Err)
+	accounts, err := fake.Rpc().GetAllAccountIds()
+	require.Nil(t, err)
+	require.Equal(t, []uint32{1}, accounts)
+
+	t.Setenv("TESTBOT_PASSPHRASE", "secret")
+	result = runFake(t, fake, "--log-level=error", "--output=json", "import", "--passphrase-env=TESTBOT_PASSPHRASE", backup)
+	require.Nil(t, result.Err)
+	require.Nil(t, json.Unmarshal([]byte(result.Stdout), &outputs))
+	require.Len(t, outputs, 1)
+	require.Equal(t, []string{"bot@example.org"}, outputs[0].Addresses)
+	isConf, err := fake.Rpc().IsConfigured(outputs[0].Id)
+	require.Nil(t, err)
+	require.True(t, isConf)
+}
+
+func TestExport_NoOverwrite(t *testing.T) {
+	t.Parallel()
+	fake := bottest.New()
+	fake.AddAccount("bot@example.org")
+	dir := t.TempDir()
+	// occupy the names of the backups saved in the next seconds
+	now := time.Now()
+	for i := range 3 {
+		name := "testbot-account1-" + now.Add(time.Duration(i)*time.Second).Format("20060102-150405") + ".tar"
+		require.Nil(t, os.WriteFile(filepath.Join(dir, name), []byte("old"), 0600))
+	}
+
+	result := runFake(t, fake, "--log-level=error", "export", dir)
+	require.ErrorContains(t, result.Err, "already exists")
+	files, err := filepath.Glob(filepath.Join(dir, "*.tar"))
+	require.Nil(t, err)
+	require.Len(t, files, 3)
+	for _, file := range files {
+		data, err := os.ReadFile(file)
+		require.Nil(t, err)
+		require.Equal(t, "old", string(data))
+	}
+}
+
+func TestScheduledBackups(t *testing.T) {
+	t.Parallel()
+	fake := bottest.New()
+	fake.AddAccount("bot@example.org")
+	dir := t.TempDir()
+	old := []string{"testbot-account1-20200101-000000.tar", "testbot-account1-20200102-000000.tar"}
+	for _, name := range old {
+		require.Nil(t, os.WriteFile(filepath.Join(dir, name), nil, 0600))
+	}
+
+	serveFake(t, botcli.New("testbot"), fake, "--backup-dir="+dir, "--backup-interval=10ms", "--backup-keep=2")
+	require.Eventually(t, func() bool {
+		_, err := os.Stat(filepath.Join(dir, old[0]))
+		return os.IsNotExist(err)
+	}, 5*time.Second, 10*time.Millisecond)
+	files, err := filepath.Glob(filepath.Join(dir, "testbot-account1-*.tar"))
+	require.Nil(t, err)
+	require.LessOrEqual(t, len(files), 2)
+}
+
+func TestScheduledBackupsAtStartup(t *testing.T) {
+	t.Parallel()
+	fake := bottest.New()
+	fake.AddAccount("bot@example.org")
+	dir := t.TempDir()
+	serveFake(t, newFakeCli(fake), fake, "--backup-dir="+dir, "--backup-interval=1h")
+	require.Eventually(t, func() bool {
+		files, _ := filepath.Glob(filepath.Join(dir, "testbot-account1-*.tar"))
+		return len(files) == 1
+	}, 5*time.Second, 10*time.Millisecond)
+
+	// with a recent backup the next one is due after the interval
+	fake = bottest.New()
+	fake.AddAccount("bot@example.org")
+	dir = t.TempDir()
+	recent := filepath.Join(dir, "testbot-account1-"+time.Now().Add(-time.Minute).Format("20060102-150405")+".tar")
+	require.Nil(t, os.WriteFile(recent, nil, 0600))
+	serveFake(t, newFakeCli(fake), fake, "--backup-dir="+dir, "--backup-interval=1h")
+	time.Sleep(100 * time.Millisecond)
+	files, err := filepath.Glob(filepath.Join(dir, "testbot-account1-*.tar"))
+	require.Nil(t, err)
+	require.Equal(t, []string{recent}, files)
+}
+
+func TestScheduledBackupsFailure(t *testing.T) {
+	t.Parallel()
+	fake := bottest.New()
+	accId := fake.AddAccount("bot@example.org")
+	dir := filepath.Join(t.TempDir(), "backups")
+
+	serveFake(t, botcli.New("testbot"), fake, "--backup-dir="+dir, "--backup-interval=10ms")
+	// make the scheduled backups fail replacing the folder with a file
+	require.Nil(t, os.RemoveAll(dir))
+	require.Nil(t, os.WriteFile(dir, nil, 0600))
+	msg, err := fake.NextSentMsg(accId, 5*time.Second)
+	require.Nil(t, err)
+	require.Contains(t, msg.Text, "Scheduled backup failed")
+}
@@ -2,50 +2,117 @@ package botcli
 
 import (
 	"context"
+	"errors"
+	"fmt"
+	"io/fs"
 	"os"
+	"os/exec"
+	"os/signal"
+	"slices"
 	"strconv"
+	"strings"
+	"syscall"
+	"time"
 
 	"github.com/chatmail/rpc-client-go/v2/deltachat"
 	"github.com/spf13/cobra"
 	"go.uber.org/zap"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
+// Version of deltachat-rpc-server this package was built against, it must match the version of
+// github.com/chatmail/rpc-client-go/v2 in go.mod. See BotCli.AllowVersionMismatch.
+const CoreVersion = "v2.49.0"
+
 type _ParsedCmd struct {
 	cmd  *cobra.Command
 	args []string
 }
 
-// A function that can be used as callback in OnBotInit(), OnBotStart() and AddCommand().
+// A function that can be used as callback in OnBotInit(), OnBotStart(), OnBotStop() and AddCommand().
 type Callback func(cli *BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string)
 
+// A function that can be used as callback in AddCommandE(), the returned error is returned by BotCli.Start().
+type CallbackE func(cli *BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string) error
+
 // A CLI program, with subcommands that help configuring and running a Delta Chat bot.
 type BotCli struct {
 	AppName string
 	// AppDir can be set by the --folder flag in command line
 	AppDir string
-	// SelectedAccount can be set by the --account flag in command line, if empty it means "all accounts"
+	// SelectedAccount can be set by the --account flag in command line, if empty it means "all accounts".
+	// Accounts selected by address are only resolved after the OnBotInit() callback
 	SelectedAccount uint32
-	RootCmd         *cobra.Command
-	Logger          *zap.SugaredLogger
-	cmdsMap         map[string]Callback
-	parsedCmd       *_ParsedCmd
-	onInit          Callback
-	onStart         Callback
+	// account ID or address given with the --account flag, resolved into SelectedAccount
+	accountSelector string
+	// OutputFormat of the built-in subcommands, can be set by the --output flag in command line
+	OutputFormat string
+	// ShutdownTimeout is how long to wait for running handlers to finish after a SIGINT/SIGTERM signal is received
+	ShutdownTimeout time.Duration
+	// RpcServerPath is the deltachat-rpc-server executable to run, it can be set with the --rpc-server option
+	RpcServerPath string
+	// RpcServerEnv are extra environment variables in the form KEY=VALUE for the deltachat-rpc-server process,
+	// ex. "RUST_LOG=info", they can be set with the --rpc-server-env option
+	RpcServerEnv []string
+	// RpcSocket is the address of an already running RPC server to connect to instead of starting
+	// deltachat-rpc-server, in the form unix:PATH or tcp:HOST:PORT, it can be set with the --rpc-socket option
+	RpcSocket string
+	// TransportFactory creates the transport used to communicate with the RPC server, if nil RpcSocket
+	// or RpcServerPath are used. It can be used to connect to the RPC server in other ways or in tests.
+	TransportFactory TransportFactory
+	// AllowVersionMismatch allows running with a deltachat-rpc-server version different from CoreVersion,
+	// it can be set with the --allow-version-mismatch option
+	AllowVersionMismatch bool
+	// LogToErrOrStderr makes the logger write to RootCmd.ErrOrStderr() instead of os.Stderr,
+	// so the logs can be redirected with RootCmd.SetErr(). It has no effect if --log-file is used
+	LogToErrOrStderr bool
+	// NotifyPanics enables reporting panics recovered in chat commands and in the OnNewMsg(), On() and
+	// OnUnhandledEvent() handlers to the admin chat
+	NotifyPanics bool
+	RootCmd      *cobra.Command
+	Logger       *zap.SugaredLogger
+	logLevel     zap.AtomicLevel
+	logOpts      logOptions
+	logFile      *lumberjack.Logger
+	cmdsMap      map[*cobra.Command]CallbackE
+	// the serve subcommand, the only one that is shut down gracefully on SIGINT/SIGTERM
+	serveCmd  *cobra.Command
+	chatCmds  map[string]*ChatCommand
+	roles     map[string]RoleChecker
+	parsedCmd *_ParsedCmd
+	onInit    Callback
+	onStart   Callback
+	onStop    Callback
+	onNewMsg  MsgHandler
+	// event handlers registered with On() by event kind
+	eventHandlers    map[string]eventHandler
+	onUnhandledEvent deltachat.EventHandler
+	metrics          *metrics
 }
 
 // Create a new BotCli instance.
 func New(appName string) *BotCli {
+	level := zap.NewAtomicLevelAt(zap.DebugLevel)
 	cli := &BotCli{
-		AppName: appName,
-		RootCmd: &cobra.Command{Use: os.Args[0]},
-		Logger:  getLogger(),
-		cmdsMap: make(map[string]Callback),
+		AppName:         appName,
+		ShutdownTimeout: 30 * time.Second,
+		RootCmd:         &cobra.Command{Use: os.Args[0]},
+		Logger:          getLogger(level),
+		logLevel:        level,
+		cmdsMap:         make(map[*cobra.Command]CallbackE),
+		chatCmds:        make(map[string]*ChatCommand),
+		roles:           make(map[string]RoleChecker),
+		eventHandlers:   make(map[string]eventHandler),
+		metrics:         newMetrics(),
 	}
 	initializeRootCmd(cli)
+	cli.addBuiltinChatCmd(logLevelCmd, "show or change the log level: debug, info, warn or error", onLogLevelCmd).Role = RoleAdmin
 	return cli
 }
 
 // Register function to be called when the bot is initialized.
+// Setting a NewMsgHandler with Bot.OnNewMsg() in the callback replaces the chat command router
+// of BotCli, disabling the built-in chat commands like /loglevel, use BotCli.OnNewMsg() instead.
 func (botcli *BotCli) OnBotInit(callback Callback) {
 	botcli.onInit = callback
 }
@@ -55,33 +122,67 @@ func (botcli *BotCli) OnBotStart(callback Callback) {
 	botcli.onStart = callback
 }
 
-// Run the CLI program.
+// Register an EventHandler for the given event type, like Bot.On() but panics in the handler are recovered
+// like in chat command handlers. Calling On() several times with the same event type overrides the
+// previously registered handler, an EventHandler set with Bot.On() in OnBotInit() takes precedence.
+func (botcli *BotCli) On(event deltachat.EventType, handler deltachat.EventHandler) {
+	botcli.eventHandlers[event.GetKind()] = eventHandler{event: event, handler: handler}
+}
+
+// Register an EventHandler to handle the events without an EventHandler, like Bot.OnUnhandledEvent()
+// but panics in the handler are recovered like in chat command handlers.
+func (botcli *BotCli) OnUnhandledEvent(handler deltachat.EventHandler) {
+	botcli.onUnhandledEvent = handler
+}
+
+// Register function to be called after the bot stopped, ex. to do cleanup before the program exits.
+// The bot's Rpc can still be used at this point.
+func (botcli *BotCli) OnBotStop(callback Callback) {
+	botcli.onStop = callback
+}
+
+// Run the CLI program. If a SIGINT or SIGTERM signal is received while serving, the bot is stopped
+// and the running handlers have up to ShutdownTimeout to finish before returning. Other subcommands,
+// and the serve subcommand if the handlers don't finish in time, return InterruptedErr.
+//
+// The error returned by the subcommand's callback is logged and returned.
 func (botcli *BotCli) Start() error {
-	defer botcli.Logger.Sync() //nolint:errcheck
+	defer func() {
+		_ = botcli.Logger.Sync()
+		if botcli.logFile != nil {
+			_ = botcli.logFile.Close()
+		}
+	}()
 	err := botcli.RootCmd.Execute()
 	if err != nil {
 		return err
 	}
 
 	if botcli.parsedCmd != nil {
+		if err := loadFlags(botcli, botcli.parsedCmd.cmd.Flags()); err != nil {
+			return err
+		}
+		if err := botcli.setupLogger(); err != nil {
+			return err
+		}
+		if botcli.OutputFormat != OutputText && botcli.OutputFormat != OutputJson {
+			return fmt.Errorf("invalid output format %q, expected %q or %q", botcli.OutputFormat, OutputText, OutputJson)
+		}
 		err = os.MkdirAll(botcli.AppDir, os.ModePerm)
 		if err != nil {
 			return err
 		}
 
-		trans := deltachat.NewIOTransport()
-		trans.AccountsDir = getAccountsDir(botcli.AppDir)
+		trans, err := botcli.newTransport()
+		if err != nil {
+			return err
+		}
 		rpc := &deltachat.Rpc{Context: context.Background(), Transport: trans}
 		defer trans.Close()
-		if err := trans.Open(); err != nil {
-			botcli.Logger.Panicf("Failed to start RPC server, read https://github.com/chatmail/core/tree/master/deltachat-rpc-server for installation instructions. Error message: %v", err)
-		}
-
-		info, err := rpc.GetSystemInfo()
-		if err != nil {
-			botcli.Logger.Panic(err)
+		if err := botcli.startRpcServer(rpc, trans); err != nil {
+			botcli.Logger.Error(err)
+			return err
 		}
-		botcli.Logger.Infof("Running deltachat core %v", info["deltachat_core_version"])
 
 		bot := deltachat.NewBot(rpc)
 		bot.On(&deltachat.EventTypeInfo{}, func(bot *deltachat.Bot, accId uint32, event deltachat.EventType) {
@@ -93,31 +194,179 @@ func (botcli *BotCli) Start() error {
 		bot.On(&deltachat.EventTypeError{}, func(bot *deltachat.Bot, accId uint32, event deltachat.EventType) {
 			botcli.GetLogger(accId).Error(event.(*deltachat.EventTypeError).Msg)
 		})
+		for _, registered := range botcli.eventHandlers {
+			bot.On(registered.event, botcli.wrapEventHandler(registered.handler))
+		}
+		if botcli.onUnhandledEvent != nil {
+			bot.OnUnhandledEvent(botcli.wrapEventHandler(botcli.onUnhandledEvent))
+		}
+		// account IDs are available in onInit, addresses are resolved after it since onInit can replace bot.Rpc
+		if id, err := strconv.ParseUint(botcli.accountSelector, 10, 32); err == nil {
+			botcli.SelectedAccount = uint32(id)
+		}
+		if !botcli.RootCmd.PersistentFlags().Changed("log-level") {
+			botcli.loadLogLevel(bot)
+		}
+		// set before onInit so the built-in chat commands work unless the bot sets its own NewMsgHandler,
+		// and set again after onInit if custom chat commands or an OnNewMsg() handler are registered
+		bot.OnNewMsg(botcli.onNewMsgRouter)
 		if botcli.onInit != nil {
 			botcli.onInit(botcli, bot, botcli.parsedCmd.cmd, botcli.parsedCmd.args)
 		}
-		callback := botcli.cmdsMap[botcli.parsedCmd.cmd.Use]
-		callback(botcli, bot, botcli.parsedCmd.cmd, botcli.parsedCmd.args)
+		if botcli.hasCustomChatCmds() || botcli.onNewMsg != nil {
+			bot.OnNewMsg(botcli.onNewMsgRouter)
+		}
+		if botcli.accountSelector != "" {
+			if botcli.SelectedAccount, err = botcli.ResolveAccount(bot, botcli.accountSelector); err != nil {
+				botcli.Logger.Error(err)
+				return err
+			}
+		}
+		callback := botcli.cmdsMap[botcli.parsedCmd.cmd]
+		err = botcli.runCallback(bot, callback)
+		if botcli.onStop != nil {
+			botcli.onStop(botcli, bot, botcli.parsedCmd.cmd, botcli.parsedCmd.args)
+		}
+		if err != nil {
+			botcli.Logger.Error(err)
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Start the RPC server and check that its version is compatible with this package.
+func (botcli *BotCli) startRpcServer(rpc *deltachat.Rpc, trans Transport) error {
+	if err := trans.Open(); err != nil {
+		if errors.Is(err, exec.ErrNotFound) || errors.Is(err, fs.ErrNotExist) {
+			return &RpcServerNotFoundErr{Err: err}
+		}
+		return &RpcServerStartErr{Err: err}
+	}
+
+	info, err := rpc.GetSystemInfo()
+	if err != nil {
+		return &RpcServerStartErr{Err: err}
+	}
+	version := info["deltachat_core_version"]
+	botcli.Logger.Infof("Running deltachat core %v", version)
+	if err := checkCoreVersion(version); err != nil {
+		if !botcli.AllowVersionMismatch {
+			return err
+		}
+		botcli.Logger.Warn(err)
 	}
+	return nil
+}
 
+// Check that the given deltachat core version matches CoreVersion.
+func checkCoreVersion(version string) error {
+	if strings.TrimPrefix(version, "v") != strings.TrimPrefix(CoreVersion, "v") {
+		return &RpcServerVersionMismatchErr{Expected: CoreVersion, Actual: version}
+	}
 	return nil
 }
 
+// Run the given subcommand callback. If a SIGINT or SIGTERM signal is received, the serve subcommand
+// is stopped gracefully and other subcommands are interrupted.
+func (botcli *BotCli) runCallback(bot *deltachat.Bot, callback CallbackE) error {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	defer signal.Stop(signals)
+
+	done := make(chan error, 1)
+	go func() {
+		done <- callback(botcli, bot, botcli.parsedCmd.cmd, botcli.parsedCmd.args)
+	}()
+
+	var sig os.Signal
+	select {
+	case err := <-done:
+		return err
+	case sig = <-signals:
+	}
+	if botcli.parsedCmd.cmd != botcli.serveCmd {
+		return &InterruptedErr{Signal: sig}
+	}
+	botcli.Logger.Infof("Received %v signal, shutting down...", sig)
+	bot.Stop()
+
+	select {
+	case err := <-done:
+		return err
+	case sig = <-signals:
+		botcli.Logger.Warn("Received second signal, exiting without waiting for running handlers")
+	case <-time.After(botcli.ShutdownTimeout):
+		botcli.Logger.Warnf("Running handlers didn't finish after %v, exiting", botcli.ShutdownTimeout)
+	}
+	return &InterruptedErr{Signal: sig}
+}
+
 // Get a logger for the given account.
 func (botcli *BotCli) GetLogger(accId uint32) *zap.SugaredLogger {
 	return botcli.Logger.With("acc", accId)
 }
 
+// Get a logger for the given incoming message, with the account, chat, message and sender contact as context.
+func (botcli *BotCli) MsgLogger(accId uint32, msg *deltachat.Message) *zap.SugaredLogger {
+	return botcli.GetLogger(accId).With("chat", msg.ChatId, "msg", msg.Id, "contact", msg.FromId)
+}
+
 // Add a subcommand to the CLI. The given callback will be executed when the command is used.
+// Callbacks should print their output to cmd.OutOrStdout() so it can be redirected with RootCmd.SetOut().
 func (botcli *BotCli) AddCommand(cmd *cobra.Command, callback Callback) {
+	botcli.AddCommandE(cmd, func(cli *BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string) error {
+		callback(cli, bot, cmd, args)
+		return nil
+	})
+}
+
+// Add a subcommand to the CLI. The given callback will be executed when the command is used,
+// if the callback returns an error, it is returned by BotCli.Start().
+// Callbacks should print their output to cmd.OutOrStdout() so it can be redirected with RootCmd.SetOut().
+func (botcli *BotCli) AddCommandE(cmd *cobra.Command, callback CallbackE) {
+	botcli.addSubcommandE(botcli.RootCmd, cmd, callback)
+}
+
+// Add a subcommand to the given parent command, see AddCommandE().
+func (botcli *BotCli) addSubcommandE(parent *cobra.Command, cmd *cobra.Command, callback CallbackE) {
 	if cmd.Run != nil {
 		panic("Can not set cmd.Run property, it would be overridden")
 	}
 	cmd.Run = func(cmd *cobra.Command, args []string) {
 		botcli.parsedCmd = &_ParsedCmd{cmd, args}
 	}
-	botcli.RootCmd.AddCommand(cmd)
-	botcli.cmdsMap[cmd.Use] = callback
+	parent.AddCommand(cmd)
+	botcli.cmdsMap[cmd] = callback
+}
+
+// Get the ID of the account matching the given selector, that can be an account ID or one of the
+// addresses of the account. If no account matches, AccountNotFoundErr is returned.
+func (botcli *BotCli) ResolveAccount(bot *deltachat.Bot, selector string) (uint32, error) {
+	accounts, err := bot.Rpc.GetAllAccountIds()
+	if err != nil {
+		return 0, err
+	}
+	if id, err := strconv.ParseUint(selector, 10, 32); err == nil {
+		if slices.Contains(accounts, uint32(id)) {
+			return uint32(id), nil
+		}
+		return 0, &AccountNotFoundErr{Addr: selector}
+	}
+
+	for _, accId := range accounts {
+		relays, err := bot.Rpc.ListTransports(accId)
+		if err != nil {
+			return 0, err
+		}
+		for _, relay := range relays {
+			if strings.EqualFold(relay.Addr, selector) {
+				return accId, nil
+			}
+		}
+	}
+	return 0, &AccountNotFoundErr{Addr: selector}
 }
 
 // Store a custom program setting in the given bot. The setting is specific to your application.
@@ -132,76 +381,15 @@ func (botcli *BotCli) GetConfig(bot *deltachat.Bot, accId uint32, key string) (*
 
 // Get the group of bot administrators.
 func (botcli *BotCli) AdminChat(bot *deltachat.Bot, accId uint32) (uint32, error) {
-	if isConf, _ := bot.Rpc.IsConfigured(accId); !isConf {
-		return 0, &BotNotConfiguredErr{}
-	}
-
-	value, err := botcli.GetConfig(bot, accId, "admin-chat")
-	if err != nil {
-		return 0, err
-	}
-
-	var chatId uint32
-
-	if value != nil {
-		chatIdInt, err := strconv.ParseUint(*value, 10, 0)
-		if err != nil {
-			return 0, err
-		}
-		chatId = uint32(chatIdInt)
-		selfInGroup, err := bot.Rpc.CanSend(accId, chatId)
-		if err != nil {
-			return 0, err
-		}
-		if !selfInGroup {
-			value = nil
-		}
-	}
-
-	if value == nil {
-		chatId, err = botcli.ResetAdminChat(bot, accId)
-		if err != nil {
-			return 0, err
-		}
-	}
-
-	return chatId, nil
+	return botcli.RoleChat(bot, accId, RoleAdmin)
 }
 
 // Reset the group of bot administrators, all the members of the old group are no longer admins.
 func (botcli *BotCli) ResetAdminChat(bot *deltachat.Bot, accId uint32) (uint32, error) {
-	if isConf, _ := bot.Rpc.IsConfigured(accId); !isConf {
-		return 0, &BotNotConfiguredErr{}
-	}
-
-	chatId, err := bot.Rpc.CreateGroupChat(accId, "Bot Administrators", false)
-	if err != nil {
-		return 0, err
-	}
-	value := strconv.FormatUint(uint64(chatId), 10)
-	err = botcli.SetConfig(bot, accId, "admin-chat", &value)
-	if err != nil {
-		return 0, err
-	}
-
-	return chatId, nil
+	return botcli.ResetRoleChat(bot, accId, RoleAdmin)
 }
 
 // Returns true if contact is in the bot administrators group, false otherwise.
 func (botcli *BotCli) IsAdmin(bot *deltachat.Bot, accId uint32, contactId uint32) (bool, error) {
-	chatId, err := botcli.AdminChat(bot, accId)
-	if err != nil {
-		return false, err
-	}
-	contacts, err := bot.Rpc.GetChatContacts(accId, chatId)
-	if err != nil {
-		return false, err
-	}
-	for _, memberId := range contacts {
-		if contactId == memberId {
-			return true, nil
-		}
-	}
-
-	return false, nil
+	return botcli.HasRole(bot, accId, contactId, RoleAdmin)
 }
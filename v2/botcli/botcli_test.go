@@ -1,8 +1,12 @@
 package botcli
 
 import (
+	"errors"
 	"fmt"
+	"os"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/chatmail/rpc-client-go/v2/deltachat"
 	"github.com/spf13/cobra"
@@ -55,6 +59,22 @@ func TestBotCli_AddCommand(t *testing.T) {
 	require.True(t, called)
 }
 
+func TestBotCli_AddCommandE(t *testing.T) {
+	t.Parallel()
+	cli := New("testbot")
+	testErr := errors.New("test error")
+	testCmd := &cobra.Command{
+		Use:   "test",
+		Short: "test subcommand",
+		Args:  cobra.ExactArgs(0),
+	}
+	cli.AddCommandE(testCmd, func(cli *BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string) error {
+		return testErr
+	})
+	_, err := RunCli(cli, "test")
+	require.Equal(t, testErr, err)
+}
+
 func TestBotCli_OnBotStart(t *testing.T) {
 	t.Parallel()
 	cli := New("testbot")
@@ -68,6 +88,55 @@ func TestBotCli_OnBotStart(t *testing.T) {
 	cliBot.Stop()
 }
 
+func TestBotCli_OnBotStop(t *testing.T) {
+	t.Parallel()
+	cli := New("testbot")
+	var stopped bool
+	cli.OnBotInit(func(cli *BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string) {
+		require.False(t, stopped)
+	})
+	cli.OnBotStop(func(cli *BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string) {
+		stopped = true
+		_, err := bot.Rpc.GetSystemInfo()
+		require.Nil(t, err)
+	})
+	_, err := RunCli(cli, "list")
+	require.Nil(t, err)
+	require.True(t, stopped)
+}
+
+// not parallel, otherwise the signal would stop other tests' bots
+func TestBotCli_runCallback(t *testing.T) {
+	cli := New("testbot")
+	cli.ShutdownTimeout = 100 * time.Millisecond
+	bot := deltachat.NewBot(nil)
+	run := func(cmd *cobra.Command, delay time.Duration) error {
+		cli.parsedCmd = &_ParsedCmd{cmd: cmd}
+		started, sent := make(chan struct{}), make(chan struct{})
+		go func() {
+			<-started
+			process, _ := os.FindProcess(os.Getpid())
+			require.Nil(t, process.Signal(os.Interrupt))
+			close(sent)
+		}()
+		return cli.runCallback(bot, func(cli *BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string) error {
+			close(started)
+			<-sent // finishing before the signal is received would make it kill the test
+			time.Sleep(delay)
+			return nil
+		})
+	}
+
+	// other subcommands are interrupted without waiting
+	var interruptedErr *InterruptedErr
+	require.ErrorAs(t, run(&cobra.Command{Use: "remove"}, time.Second), &interruptedErr)
+	require.Equal(t, os.Interrupt, interruptedErr.Signal)
+
+	// the serve subcommand waits for the running handlers to finish
+	require.Nil(t, run(cli.serveCmd, 20*time.Millisecond))
+	require.ErrorAs(t, run(cli.serveCmd, time.Second), &interruptedErr)
+}
+
 func TestBotCli_serve(t *testing.T) {
 	t.Parallel()
 	cli := New("testbot")
@@ -122,9 +191,12 @@ func TestConfigCallback(t *testing.T) {
 	cli := New("testbot")
 
 	_, err = RunCli(cli, "config", "addr")
+	require.Equal(t, &NoAccountsErr{}, err)
+
+	_, err = RunConfiguredCli(cli, "config", "addr")
 	require.Nil(t, err)
 
-	_, err = RunCli(cli, "config", "addr", "test@example.com")
+	_, err = RunConfiguredCli(cli, "config", "displayname", "test bot")
 	require.Nil(t, err)
 }
 
@@ -133,7 +205,7 @@ func TestQrCallback(t *testing.T) {
 	var err error
 	cli := New("testbot")
 	_, err = RunCli(cli, "link")
-	require.Nil(t, err)
+	require.Equal(t, &NoAccountsErr{}, err)
 
 	_, err = RunConfiguredCli(cli, "link")
 	require.Nil(t, err)
@@ -144,7 +216,7 @@ func TestAdminCallback(t *testing.T) {
 	var err error
 	cli := New("testbot")
 	_, err = RunCli(cli, "admin")
-	require.Nil(t, err)
+	require.Equal(t, &NoAccountsErr{}, err)
 
 	_, err = RunConfiguredCli(cli, "admin")
 	require.Nil(t, err)
@@ -152,3 +224,106 @@ func TestAdminCallback(t *testing.T) {
 	_, err = RunConfiguredCli(cli, "admin", "-r")
 	require.Nil(t, err)
 }
+
+func TestBotCli_HasRole(t *testing.T) {
+	t.Parallel()
+	cli := New("testbot")
+	cli.AddRole("moderator", func(cli *BotCli, bot *deltachat.Bot, accId uint32, contactId uint32) (bool, error) {
+		return contactId == 10, nil
+	})
+
+	hasRole, err := cli.HasRole(nil, 1, 11, RolePublic)
+	require.Nil(t, err)
+	require.True(t, hasRole)
+
+	hasRole, err = cli.HasRole(nil, 1, 10, "moderator")
+	require.Nil(t, err)
+	require.True(t, hasRole)
+	hasRole, err = cli.HasRole(nil, 1, 11, "moderator")
+	require.Nil(t, err)
+	require.False(t, hasRole)
+
+	_, err = cli.HasRole(nil, 1, 10, "unknown")
+	require.Equal(t, &RoleNotFoundErr{Role: "unknown"}, err)
+
+	cli.AddRole("operator", nil)
+	cli.AddRole("billing", nil)
+	require.Equal(t, []string{RoleAdmin, "billing", "operator"}, cli.ChatRoles())
+}
+
+func TestBotCli_RoleChat(t *testing.T) {
+	t.Parallel()
+	acfactory.WithOnlineBot(func(bot *deltachat.Bot, accId uint32) {
+		cli := New("testbot")
+		cli.AddRole("moderator", nil)
+		adminChatId, err := cli.AdminChat(bot, accId)
+		require.Nil(t, err)
+		chatId1, err := cli.RoleChat(bot, accId, "moderator")
+		require.Nil(t, err)
+		require.NotEqual(t, adminChatId, chatId1)
+		chatId2, err := cli.ResetRoleChat(bot, accId, "moderator")
+		require.Nil(t, err)
+		require.NotEqual(t, chatId2, chatId1)
+
+		hasRole, err := cli.HasRole(bot, accId, deltachat.ContactSelf, "moderator")
+		require.Nil(t, err)
+		require.True(t, hasRole)
+	})
+}
+
+func TestRolesCallback(t *testing.T) {
+	t.Parallel()
+	var err error
+	cli := New("testbot")
+	cli.AddRole("moderator", nil)
+	_, err = RunCli(cli, "roles")
+	require.Equal(t, &NoAccountsErr{}, err)
+
+	_, err = RunCli(cli, "roles", "unknown")
+	require.Equal(t, &RoleNotFoundErr{Role: "unknown"}, err)
+
+	_, err = RunConfiguredCli(cli, "roles")
+	require.Nil(t, err)
+
+	_, err = RunConfiguredCli(cli, "roles", "moderator", "-r")
+	require.Nil(t, err)
+}
+
+func TestBotCli_startRpcServer(t *testing.T) {
+	t.Setenv("TESTBOT_RPC_VAR", "")
+	_, err := RunCli(New("testbot"), "--rpc-server-env=INVALID", "list")
+	require.ErrorContains(t, err, "expected KEY=VALUE")
+
+	var notFoundErr *RpcServerNotFoundErr
+	_, err = RunCli(New("testbot"), "--rpc-server=/non-existent/deltachat-rpc-server", "--rpc-server-env=TESTBOT_RPC_VAR=1", "list")
+	require.ErrorAs(t, err, &notFoundErr)
+	require.Equal(t, "", os.Getenv("TESTBOT_RPC_VAR"))
+
+	t.Setenv("PATH", t.TempDir())
+	_, err = RunCli(New("testbot"), "list")
+	require.ErrorAs(t, err, &notFoundErr)
+}
+
+func TestCheckCoreVersion(t *testing.T) {
+	t.Parallel()
+	require.Nil(t, checkCoreVersion(CoreVersion))
+	require.Nil(t, checkCoreVersion(strings.TrimPrefix(CoreVersion, "v")))
+	var mismatchErr *RpcServerVersionMismatchErr
+	require.ErrorAs(t, checkCoreVersion("v1.0.0"), &mismatchErr)
+	require.Equal(t, "v1.0.0", mismatchErr.Actual)
+	require.Equal(t, CoreVersion, mismatchErr.Expected)
+}
+
+func TestCoreVersion_MatchesGoMod(t *testing.T) {
+	t.Parallel()
+	data, err := os.ReadFile("../go.mod")
+	require.Nil(t, err)
+	var version string
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 2 && fields[0] == "github.com/chatmail/rpc-client-go/v2" {
+			version = fields[1]
+		}
+	}
+	require.Equal(t, version, CoreVersion, "update CoreVersion after upgrading rpc-client-go")
+}
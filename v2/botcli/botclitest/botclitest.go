@@ -0,0 +1,61 @@
+// Package botclitest provides helpers to test programs built with botcli, including their custom subcommands.
+package botclitest
+
+import (
+	"bytes"
+	"path/filepath"
+	"testing"
+
+	"github.com/chatmail/rpc-client-go/v2/deltachat"
+	"github.com/deltachat-bot/deltabot-cli-go/v2/botcli"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+)
+
+// Result of running a CLI program with RunCli() or RunConfiguredCli().
+type Result struct {
+	// Output of the subcommand, written to the root command's output
+	Stdout string
+	// Usage and error messages printed by cobra
+	Stderr string
+	// Messages logged by the program, in console format
+	Log string
+	// Error returned by BotCli.Start()
+	Err error
+}
+
+// Run the given CLI program with the given command line arguments using a new empty data folder.
+//
+// The messages logged by the program are captured in Result.Log unless the --log-format or --log-file
+// options are used.
+func RunCli(t testing.TB, cli *botcli.BotCli, args ...string) *Result {
+	args = append([]string{"-f=" + t.TempDir()}, args...)
+	return run(cli, args...)
+}
+
+// Run the given CLI program with the given command line arguments using the data folder of a new bot
+// with a configured online account (account #1) created with the given AcFactory.
+// The AcFactory must be set up with TearUp(), ex. in TestMain().
+func RunConfiguredCli(acfactory *deltachat.AcFactory, cli *botcli.BotCli, args ...string) *Result {
+	var dir string
+	acfactory.WithOnlineBot(func(bot *deltachat.Bot, accId uint32) {
+		dir = filepath.Dir(bot.Rpc.Transport.(*deltachat.IOTransport).AccountsDir)
+	})
+	args = append([]string{"-f=" + dir}, args...)
+	return run(cli, args...)
+}
+
+func run(cli *botcli.BotCli, args ...string) *Result {
+	stdout, stderr, log := new(bytes.Buffer), new(bytes.Buffer), new(bytes.Buffer)
+	cli.RootCmd.SetOut(stdout)
+	cli.RootCmd.SetErr(stderr)
+	cli.RootCmd.SetArgs(args)
+	// log to the buffer keeping the level of the program's logger
+	cli.Logger = cli.Logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		encoder := zapcore.NewConsoleEncoder(zap.NewDevelopmentEncoderConfig())
+		return zapcore.NewCore(encoder, zapcore.AddSync(log), core)
+	}))
+
+	err := cli.Start()
+	return &Result{Stdout: stdout.String(), Stderr: stderr.String(), Log: log.String(), Err: err}
+}
@@ -0,0 +1,38 @@
+package botclitest_test
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/deltachat-bot/deltabot-cli-go/v2/botcli"
+	"github.com/deltachat-bot/deltabot-cli-go/v2/botcli/botclitest"
+	"github.com/deltachat-bot/deltabot-cli-go/v2/botcli/bottest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRunCli(t *testing.T) {
+	t.Parallel()
+	fake := bottest.New()
+	fake.AddAccount("bot@example.org")
+	cli := botcli.New("testbot")
+	cli.TransportFactory = fake.Factory
+
+	result := botclitest.RunCli(t, cli, "--output=json", "--log-level=info", "list")
+	require.Nil(t, result.Err)
+	var accounts []map[string]any
+	require.Nil(t, json.Unmarshal([]byte(result.Stdout), &accounts))
+	require.Equal(t, []any{"bot@example.org"}, accounts[0]["addresses"])
+	require.Contains(t, result.Log, "Running deltachat core")
+	require.Empty(t, result.Stderr)
+
+	cli = botcli.New("testbot")
+	cli.TransportFactory = fake.Factory
+	result = botclitest.RunCli(t, cli, "--log-level=error", "list")
+	require.Nil(t, result.Err)
+	require.Contains(t, result.Stdout, "bot@example.org")
+	require.Empty(t, result.Log)
+
+	result = botclitest.RunCli(t, botcli.New("testbot"), "unknown")
+	require.NotNil(t, result.Err)
+	require.Contains(t, result.Stderr, "unknown command")
+}
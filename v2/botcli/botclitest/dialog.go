@@ -0,0 +1,238 @@
+package botclitest
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/chatmail/rpc-client-go/v2/deltachat"
+)
+
+// Dialog is a scripted conversation between one or more user accounts and a running bot in 1:1 chats.
+// Failed expectations stop the test showing the transcript of the conversation.
+type Dialog struct {
+	// Users taking part in the conversation, in the order of the names given to WithDialog()
+	Users      []*User
+	t          testing.TB
+	transcript []string
+}
+
+// User is an online user account taking part in a Dialog, it has a 1:1 chat with the bot.
+type User struct {
+	// Name of the user in the transcript of the conversation
+	Name   string
+	Rpc    *deltachat.Rpc
+	AccId  uint32
+	ChatId uint32
+	dialog *Dialog
+	// payloads of the status updates sent by the user
+	sentPayloads map[string]bool
+	mu           sync.Mutex
+	events       []deltachat.EventType
+	closed       bool
+	// closed and replaced when events are added or the event stream is closed
+	changed chan struct{}
+}
+
+// Create a new online user account for each of the given names, with a 1:1 chat with the given bot account,
+// and run the given conversation. The bot must be running and the AcFactory must be set up with TearUp(),
+// ex. in TestMain().
+func WithDialog(t testing.TB, acfactory *deltachat.AcFactory, bot *deltachat.Bot, botAccId uint32, names []string, callback func(d *Dialog)) {
+	acfactory.WithRpc(func(rpc *deltachat.Rpc) {
+		d := &Dialog{t: t}
+		for _, name := range names {
+			accId, err := rpc.AddAccount()
+			if err != nil {
+				t.Fatalf("failed to add account for %v: %v", name, err)
+			}
+			if err := rpc.AddTransportFromQr(accId, acfactory.ConfigQr); err != nil {
+				t.Fatalf("failed to configure account for %v: %v", name, err)
+			}
+			user := &User{Name: name, Rpc: rpc, AccId: accId, dialog: d, sentPayloads: make(map[string]bool), changed: make(chan struct{})}
+			user.ChatId = acfactory.CreateChat(rpc, accId, bot.Rpc, botAccId)
+			d.Users = append(d.Users, user)
+		}
+
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		go d.pumpEvents(ctx, rpc)
+		callback(d)
+	})
+}
+
+// Forward the events of the users' accounts to the users until the given context is canceled.
+func (d *Dialog) pumpEvents(ctx context.Context, rpc *deltachat.Rpc) {
+	rpc = &deltachat.Rpc{Context: ctx, Transport: rpc.Transport}
+	users := make(map[uint32]*User)
+	for _, user := range d.Users {
+		users[user.AccId] = user
+	}
+	for {
+		event, err := rpc.GetNextEvent()
+		if err != nil {
+			for _, user := range d.Users {
+				user.mu.Lock()
+				user.closed = true
+				user.notify()
+				user.mu.Unlock()
+			}
+			return
+		}
+		if user, ok := users[event.ContextId]; ok {
+			user.mu.Lock()
+			user.events = append(user.events, event.Event)
+			user.notify()
+			user.mu.Unlock()
+		}
+	}
+}
+
+// Stop the test showing the transcript of the conversation.
+func (d *Dialog) fail(format string, args ...any) {
+	d.t.Helper()
+	d.t.Fatalf("%v\n\nTranscript:\n%v", fmt.Sprintf(format, args...), strings.Join(d.transcript, "\n"))
+}
+
+// Send a text message to the bot.
+func (user *User) Send(text string) {
+	user.dialog.t.Helper()
+	if _, err := user.Rpc.MiscSendTextMessage(user.AccId, user.ChatId, text); err != nil {
+		user.dialog.fail("%v failed to send %q: %v", user.Name, text, err)
+	}
+	user.log(text)
+}
+
+// Send a file to the bot, returns the ID of the sent message.
+func (user *User) SendFile(path string, text string) uint32 {
+	user.dialog.t.Helper()
+	msgId, err := user.Rpc.SendMsg(user.AccId, user.ChatId, deltachat.MessageData{File: &path, Text: &text})
+	if err != nil {
+		user.dialog.fail("%v failed to send file %v: %v", user.Name, path, err)
+	}
+	user.log(fmt.Sprintf("[file %v] %v", filepath.Base(path), text))
+	return msgId
+}
+
+// Wait for the next reply of the bot to the user and check that its text matches the given regular expression.
+func (user *User) ExpectReply(pattern string, timeout time.Duration) deltachat.Message {
+	user.dialog.t.Helper()
+	event := user.waitFor(func(event deltachat.EventType) bool {
+		ev, ok := event.(*deltachat.EventTypeIncomingMsg)
+		return ok && ev.ChatId == user.ChatId
+	}, timeout, "reply matching %q", pattern).(*deltachat.EventTypeIncomingMsg)
+
+	msg, err := user.Rpc.GetMessage(user.AccId, event.MsgId)
+	if err != nil {
+		user.dialog.fail("failed to get message: %v", err)
+	}
+	if msg.FileName != nil {
+		user.logBot(fmt.Sprintf("[file %v] %v", *msg.FileName, msg.Text))
+	} else {
+		user.logBot(msg.Text)
+	}
+	if !regexp.MustCompile(pattern).MatchString(msg.Text) {
+		user.dialog.fail("expected reply to %v matching %q, got %q", user.Name, pattern, msg.Text)
+	}
+	return msg
+}
+
+// Wait for the next status update of the given webxdc message not sent by the user
+// and check that it matches the given regular expression.
+func (user *User) ExpectStatusUpdate(msgId uint32, pattern string, timeout time.Duration) json.RawMessage {
+	user.dialog.t.Helper()
+	for {
+		event := user.waitFor(func(event deltachat.EventType) bool {
+			ev, ok := event.(*deltachat.EventTypeWebxdcStatusUpdate)
+			return ok && ev.MsgId == msgId
+		}, timeout, "status update matching %q", pattern).(*deltachat.EventTypeWebxdcStatusUpdate)
+
+		data, err := user.Rpc.GetWebxdcStatusUpdates(user.AccId, msgId, event.StatusUpdateSerial-1)
+		if err != nil {
+			user.dialog.fail("failed to get status update: %v", err)
+		}
+		var updates []json.RawMessage
+		if err := json.Unmarshal([]byte(data), &updates); err != nil || len(updates) == 0 {
+			user.dialog.fail("invalid status updates %q: %v", data, err)
+		}
+		if user.sentPayloads[payloadOf(updates[0])] {
+			continue
+		}
+		user.logBot(fmt.Sprintf("[status update] %s", updates[0]))
+		if !regexp.MustCompile(pattern).Match(updates[0]) {
+			user.dialog.fail("expected status update for %v matching %q, got %s", user.Name, pattern, updates[0])
+		}
+		return updates[0]
+	}
+}
+
+// Send a status update to the given webxdc message.
+func (user *User) SendStatusUpdate(msgId uint32, update string) {
+	user.dialog.t.Helper()
+	if err := user.Rpc.SendWebxdcStatusUpdate(user.AccId, msgId, update, nil); err != nil {
+		user.dialog.fail("%v failed to send status update %v: %v", user.Name, update, err)
+	}
+	user.sentPayloads[payloadOf(json.RawMessage(update))] = true
+	user.log("[status update] " + update)
+}
+
+// Get the compacted payload of the given status update.
+func payloadOf(update json.RawMessage) string {
+	var fields struct{ Payload json.RawMessage }
+	_ = json.Unmarshal(update, &fields)
+	var payload bytes.Buffer
+	_ = json.Compact(&payload, fields.Payload)
+	return payload.String()
+}
+
+// Add a line sent by the user to the transcript.
+func (user *User) log(line string) {
+	user.dialog.transcript = append(user.dialog.transcript, user.Name+": "+line)
+}
+
+// Add a line sent by the bot to the user to the transcript.
+func (user *User) logBot(line string) {
+	user.dialog.transcript = append(user.dialog.transcript, "bot to "+user.Name+": "+line)
+}
+
+// Wait for the first event accepted by the given filter.
+func (user *User) waitFor(filter func(deltachat.EventType) bool, timeout time.Duration, format string, args ...any) deltachat.EventType {
+	user.dialog.t.Helper()
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		user.mu.Lock()
+		if len(user.events) != 0 {
+			event := user.events[0]
+			user.events = user.events[1:]
+			user.mu.Unlock()
+			if filter(event) {
+				return event
+			}
+			continue
+		}
+		closed, changed := user.closed, user.changed
+		user.mu.Unlock()
+
+		if closed {
+			user.dialog.fail("event stream closed while %v was waiting for %v", user.Name, fmt.Sprintf(format, args...))
+		}
+		select {
+		case <-changed:
+		case <-timer.C:
+			user.dialog.fail("timed out after %v while %v was waiting for %v", timeout, user.Name, fmt.Sprintf(format, args...))
+		}
+	}
+}
+
+// Wake up the goroutine waiting for events, must be called holding the lock.
+func (user *User) notify() {
+	close(user.changed)
+	user.changed = make(chan struct{})
+}
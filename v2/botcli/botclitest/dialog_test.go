@@ -0,0 +1,62 @@
+package botclitest_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chatmail/rpc-client-go/v2/deltachat"
+	"github.com/deltachat-bot/deltabot-cli-go/v2/botcli"
+	"github.com/deltachat-bot/deltabot-cli-go/v2/botcli/botclitest"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestWithDialog(t *testing.T) {
+	t.Parallel()
+	cli := botcli.New("testbot")
+	botChan := make(chan *deltachat.Bot, 1)
+	cli.OnBotStart(func(cli *botcli.BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string) {
+		botChan <- bot
+	})
+	cli.AddChatCommand("start", "", func(cli *botcli.BotCli, bot *deltachat.Bot, req *botcli.ChatRequest) {
+		require.Nil(t, req.Reply(bot, "Welcome! Send me a mini-app"))
+	})
+	cli.OnNewMsg(func(cli *botcli.BotCli, bot *deltachat.Bot, accId uint32, msg *deltachat.Message, logger *zap.SugaredLogger) {
+		if msg.ViewType == deltachat.ViewtypeWebxdc {
+			require.Nil(t, bot.Rpc.SendWebxdcStatusUpdate(accId, msg.Id, `{"payload": "hello"}`, nil))
+		}
+	})
+	results := make(chan *botclitest.Result, 1)
+	go func() { results <- botclitest.RunConfiguredCli(acfactory, cli, "serve") }()
+
+	var bot *deltachat.Bot
+	select {
+	case bot = <-botChan:
+	case result := <-results:
+		t.Fatalf("bot exited before starting: %v\n%v", result.Err, result.Log)
+	case <-time.After(30 * time.Second):
+		t.Fatal("timed out waiting for the bot to start")
+	}
+	// stop the bot and wait for serve to return before the test and its AcFactory are torn down
+	t.Cleanup(func() {
+		bot.Stop()
+		select {
+		case result := <-results:
+			require.Nil(t, result.Err, result.Log)
+		case <-time.After(30 * time.Second):
+			t.Error("timed out waiting for the bot to stop")
+		}
+	})
+	require.Eventually(t, bot.IsRunning, 30*time.Second, 10*time.Millisecond)
+
+	botclitest.WithDialog(t, acfactory, bot, 1, []string{"alice", "bob"}, func(d *botclitest.Dialog) {
+		alice, bob := d.Users[0], d.Users[1]
+		alice.Send("/start")
+		bob.Send("/start")
+		alice.ExpectReply("^Welcome!", 30*time.Second)
+		bob.ExpectReply("^Welcome!", 30*time.Second)
+		msgId := alice.SendFile(acfactory.TestWebxdc(), "")
+		alice.ExpectStatusUpdate(msgId, `"payload":\s*"hello"`, 30*time.Second)
+	})
+}
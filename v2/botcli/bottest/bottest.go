@@ -0,0 +1,462 @@
+// Package bottest provides an in-memory fake of the Delta Chat RPC server to unit test bots
+// built with botcli without running deltachat-rpc-server or accessing the network.
+//
+// The fake Transport simulates accounts, contacts, chats, messages, configuration keys and
+// webxdc status updates. Tests inject it with BotCli.TransportFactory, simulate incoming
+// messages with ReceiveText() or ReceiveMsg() and check the bot replies with NextSentMsg():
+//
+//	fake := bottest.New()
+//	accId := fake.AddAccount("bot@example.org")
+//	cli.TransportFactory = fake.Factory
+//	go cli.Start()
+//	fake.ReceiveText(accId, "alice@example.org", "/help")
+//	reply, err := fake.NextSentMsg(accId, time.Second)
+package bottest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chatmail/rpc-client-go/v2/deltachat"
+	"github.com/deltachat-bot/deltabot-cli-go/v2/botcli"
+)
+
+// Connectivity values reported by the fake, see Rpc.GetConnectivity().
+const (
+	connectivityNotConnected = 1000
+	connectivityConnected    = 4000
+)
+
+// Last special chat and message IDs, IDs of regular chats and messages start after them.
+const lastSpecialId = 9
+
+// Transport is an in-memory fake of the Delta Chat RPC server implementing botcli.Transport.
+// It is safe for concurrent use.
+type Transport struct {
+	// SystemInfo is returned by Rpc.GetSystemInfo(), by default it reports botcli.CoreVersion
+	SystemInfo map[string]string
+	mu         sync.Mutex
+	// closed and recreated every time the state changes, to wake up the goroutines waiting for events or messages
+	changed   chan struct{}
+	closed    bool
+	events    []deltachat.Event
+	accounts  map[uint32]*account
+	lastAccId uint32
+}
+
+type account struct {
+	transports    []deltachat.EnteredLoginParam
+	config        map[string]string
+	contacts      map[uint32]*deltachat.Contact
+	chats         map[uint32]*chat
+	msgs          map[uint32]*deltachat.Message
+	updates       map[uint32][]map[string]json.RawMessage
+	outgoing      []uint32
+	readOutgoing  int
+	lastContactId uint32
+	lastChatId    uint32
+	lastMsgId     uint32
+	lastSerial    uint32
+}
+
+type chat struct {
+	info     deltachat.BasicChat
+	contacts []uint32
+	msgs     []uint32
+}
+
+// Create a new fake RPC server without accounts.
+func New() *Transport {
+	return &Transport{
+		SystemInfo: map[string]string{"deltachat_core_version": botcli.CoreVersion},
+		changed:    make(chan struct{}),
+		accounts:   make(map[uint32]*account),
+	}
+}
+
+// Factory returns the fake, it can be used as BotCli.TransportFactory.
+func (trans *Transport) Factory(cli *botcli.BotCli) (botcli.Transport, error) {
+	return trans, nil
+}
+
+// Open does nothing, the fake is always ready, it is reopened if it was closed.
+func (trans *Transport) Open() error {
+	trans.mu.Lock()
+	defer trans.mu.Unlock()
+	trans.closed = false
+	return nil
+}
+
+// Close makes the pending and future Rpc.GetNextEvent() calls fail, the simulated state is kept.
+func (trans *Transport) Close() {
+	trans.mu.Lock()
+	defer trans.mu.Unlock()
+	trans.closed = true
+	trans.notify()
+}
+
+// Call requests the fake RPC server to call a function that does not have a return value.
+func (trans *Transport) Call(ctx context.Context, method string, params ...any) error {
+	_, err := trans.call(ctx, method, params)
+	return err
+}
+
+// CallResult requests the fake RPC server to call a function that does have a return value.
+func (trans *Transport) CallResult(ctx context.Context, result any, method string, params ...any) error {
+	value, err := trans.call(ctx, method, params)
+	if err != nil {
+		return err
+	}
+	if event, ok := value.(deltachat.Event); ok {
+		*result.(*deltachat.Event) = event
+		return nil
+	}
+	// copy the value so callers can't modify the simulated state
+	data, err := json.Marshal(value)
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, result)
+}
+
+// Rpc returns a deltachat.Rpc using the fake, to inspect or modify the simulated state in tests.
+func (trans *Transport) Rpc() *deltachat.Rpc {
+	return &deltachat.Rpc{Context: context.Background(), Transport: trans}
+}
+
+// AddAccount creates a new account configured with the given address, if the address is empty
+// the account is not configured. Returns the ID of the new account.
+func (trans *Transport) AddAccount(addr string) uint32 {
+	trans.mu.Lock()
+	defer trans.mu.Unlock()
+	accId := trans.addAccount()
+	if addr != "" {
+		trans.accounts[accId].transports = []deltachat.EnteredLoginParam{{Addr: addr}}
+	}
+	return accId
+}
+
+// AddContact returns the ID of the contact with the given address, creating it if it doesn't exist.
+// It panics if the account doesn't exist.
+func (trans *Transport) AddContact(accId uint32, addr string, name string) uint32 {
+	trans.mu.Lock()
+	defer trans.mu.Unlock()
+	return trans.mustAccount(accId).addContact(addr, name)
+}
+
+// CreateChat returns the ID of the 1:1 chat with the given contact, creating it if it doesn't exist.
+// It panics if the account doesn't exist.
+func (trans *Transport) CreateChat(accId uint32, contactId uint32) uint32 {
+	trans.mu.Lock()
+	defer trans.mu.Unlock()
+	return trans.mustAccount(accId).createChat(contactId)
+}
+
+// CreateGroup creates a group chat with the bot and the given contacts as members, returns the ID of the new chat.
+// It panics if the account doesn't exist.
+func (trans *Transport) CreateGroup(accId uint32, name string, contactIds ...uint32) uint32 {
+	trans.mu.Lock()
+	defer trans.mu.Unlock()
+	acc := trans.mustAccount(accId)
+	chatId := acc.createGroup(name)
+	acc.chats[chatId].contacts = append(acc.chats[chatId].contacts, contactIds...)
+	return chatId
+}
+
+// ReceiveMsg simulates an incoming message sent by the given contact in the given chat,
+// an IncomingMsg event is emitted. Returns the ID of the new message.
+// It panics if the account or chat doesn't exist.
+func (trans *Transport) ReceiveMsg(accId uint32, chatId uint32, contactId uint32, data deltachat.MessageData) uint32 {
+	trans.mu.Lock()
+	defer trans.mu.Unlock()
+	acc := trans.mustAccount(accId)
+	if _, ok := acc.chats[chatId]; !ok {
+		panic(fmt.Sprintf("chat #%v not found in account #%v", chatId, accId))
+	}
+	msg := acc.addMsg(chatId, contactId, data)
+	trans.emit(accId, &deltachat.EventTypeIncomingMsg{ChatId: chatId, MsgId: msg.Id})
+	return msg.Id
+}
+
+// ReceiveText simulates an incoming text message sent in a 1:1 chat by the contact with the given address,
+// the contact and chat are created if needed. Returns the ID of the new message.
+// It panics if the account doesn't exist.
+func (trans *Transport) ReceiveText(accId uint32, addr string, text string) uint32 {
+	contactId := trans.AddContact(accId, addr, "")
+	chatId := trans.CreateChat(accId, contactId)
+	return trans.ReceiveMsg(accId, chatId, contactId, deltachat.MessageData{Text: &text})
+}
+
+// ReceiveWebxdcUpdate simulates a webxdc status update received for the given webxdc message,
+// a WebxdcStatusUpdate event is emitted. Returns the serial of the update.
+// It panics if the account doesn't exist.
+func (trans *Transport) ReceiveWebxdcUpdate(accId uint32, msgId uint32, update string) (uint32, error) {
+	trans.mu.Lock()
+	defer trans.mu.Unlock()
+	return trans.addWebxdcUpdate(trans.mustAccount(accId), accId, msgId, update)
+}
+
+// WebxdcUpdates returns all the status updates of the given webxdc message, including the ones sent by the bot.
+func (trans *Transport) WebxdcUpdates(accId uint32, msgId uint32) []json.RawMessage {
+	trans.mu.Lock()
+	defer trans.mu.Unlock()
+	var updates []json.RawMessage
+	for _, update := range trans.mustAccount(accId).updates[msgId] {
+		data, _ := json.Marshal(update)
+		updates = append(updates, data)
+	}
+	return updates
+}
+
+// Emit queues the given event to be processed by the bot.
+func (trans *Transport) Emit(accId uint32, event deltachat.EventType) {
+	trans.mu.Lock()
+	defer trans.mu.Unlock()
+	trans.emit(accId, event)
+}
+
+// SentMsgs returns all the messages sent by the given account.
+func (trans *Transport) SentMsgs(accId uint32) []deltachat.Message {
+	trans.mu.Lock()
+	defer trans.mu.Unlock()
+	acc := trans.mustAccount(accId)
+	msgs := make([]deltachat.Message, 0, len(acc.outgoing))
+	for _, msgId := range acc.outgoing {
+		msgs = append(msgs, *acc.msgs[msgId])
+	}
+	return msgs
+}
+
+// NextSentMsg returns the oldest message sent by the given account not returned yet by NextSentMsg(),
+// waiting up to the given timeout for the bot to send it.
+func (trans *Transport) NextSentMsg(accId uint32, timeout time.Duration) (deltachat.Message, error) {
+	timer := time.NewTimer(timeout)
+	defer timer.Stop()
+	for {
+		trans.mu.Lock()
+		acc, err := trans.getAccount(accId)
+		if err != nil {
+			trans.mu.Unlock()
+			return deltachat.Message{}, err
+		}
+		if acc.readOutgoing < len(acc.outgoing) {
+			msg := *acc.msgs[acc.outgoing[acc.readOutgoing]]
+			acc.readOutgoing++
+			trans.mu.Unlock()
+			return msg, nil
+		}
+		changed := trans.changed
+		trans.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-timer.C:
+			return deltachat.Message{}, fmt.Errorf("account #%v didn't send any message in %v", accId, timeout)
+		}
+	}
+}
+
+// Wait for the next event, it must be called without holding the lock.
+func (trans *Transport) nextEvent(ctx context.Context) (deltachat.Event, error) {
+	for {
+		trans.mu.Lock()
+		if trans.closed {
+			trans.mu.Unlock()
+			return deltachat.Event{}, errors.New("transport closed")
+		}
+		if len(trans.events) != 0 {
+			event := trans.events[0]
+			trans.events = trans.events[1:]
+			trans.mu.Unlock()
+			return event, nil
+		}
+		changed := trans.changed
+		trans.mu.Unlock()
+
+		select {
+		case <-changed:
+		case <-ctx.Done():
+			return deltachat.Event{}, ctx.Err()
+		}
+	}
+}
+
+// Wake up the goroutines waiting for changes, must be called holding the lock.
+func (trans *Transport) notify() {
+	close(trans.changed)
+	trans.changed = make(chan struct{})
+}
+
+func (trans *Transport) emit(accId uint32, event deltachat.EventType) {
+	trans.events = append(trans.events, deltachat.Event{ContextId: accId, Event: event})
+	trans.notify()
+}
+
+func (trans *Transport) addAccount() uint32 {
+	trans.lastAccId++
+	trans.accounts[trans.lastAccId] = &account{
+		config:        make(map[string]string),
+		contacts:      map[uint32]*deltachat.Contact{deltachat.ContactSelf: {Id: deltachat.ContactSelf, DisplayName: "Me"}},
+		chats:         make(map[uint32]*chat),
+		msgs:          make(map[uint32]*deltachat.Message),
+		updates:       make(map[uint32][]map[string]json.RawMessage),
+		lastContactId: deltachat.ContactLastSpecial,
+		lastChatId:    lastSpecialId,
+		lastMsgId:     lastSpecialId,
+	}
+	return trans.lastAccId
+}
+
+func (trans *Transport) getAccount(accId uint32) (*account, error) {
+	acc, ok := trans.accounts[accId]
+	if !ok {
+		return nil, fmt.Errorf("account #%v not found", accId)
+	}
+	return acc, nil
+}
+
+func (trans *Transport) mustAccount(accId uint32) *account {
+	acc, err := trans.getAccount(accId)
+	if err != nil {
+		panic(err)
+	}
+	return acc
+}
+
+func (trans *Transport) addWebxdcUpdate(acc *account, accId uint32, msgId uint32, update string) (uint32, error) {
+	if _, ok := acc.msgs[msgId]; !ok {
+		return 0, fmt.Errorf("message #%v not found", msgId)
+	}
+	var fields map[string]json.RawMessage
+	if err := json.Unmarshal([]byte(update), &fields); err != nil {
+		return 0, fmt.Errorf("invalid status update: %w", err)
+	}
+	acc.lastSerial++
+	fields["serial"], _ = json.Marshal(acc.lastSerial)
+	acc.updates[msgId] = append(acc.updates[msgId], fields)
+	trans.emit(accId, &deltachat.EventTypeWebxdcStatusUpdate{MsgId: msgId, StatusUpdateSerial: acc.lastSerial})
+	return acc.lastSerial, nil
+}
+
+// Address of the account, empty if it is not configured.
+func (acc *account) addr() string {
+	if len(acc.transports) == 0 {
+		return ""
+	}
+	return acc.transports[0].Addr
+}
+
+func (acc *account) addContact(addr string, name string) uint32 {
+	for _, contact := range acc.contacts {
+		if contact.Id > deltachat.ContactLastSpecial && strings.EqualFold(contact.Address, addr) {
+			return contact.Id
+		}
+	}
+	acc.lastContactId++
+	displayName := name
+	if displayName == "" {
+		displayName = addr
+	}
+	acc.contacts[acc.lastContactId] = &deltachat.Contact{
+		Id:          acc.lastContactId,
+		Address:     addr,
+		Name:        name,
+		DisplayName: displayName,
+		NameAndAddr: displayName + " (" + addr + ")",
+	}
+	return acc.lastContactId
+}
+
+func (acc *account) contact(contactId uint32) (deltachat.Contact, error) {
+	contact, ok := acc.contacts[contactId]
+	if !ok {
+		return deltachat.Contact{}, fmt.Errorf("contact #%v not found", contactId)
+	}
+	if contactId == deltachat.ContactSelf {
+		self := *contact
+		self.Address = acc.addr()
+		return self, nil
+	}
+	return *contact, nil
+}
+
+func (acc *account) createChat(contactId uint32) uint32 {
+	for _, chat := range acc.chats {
+		if chat.info.ChatType == deltachat.ChatTypeSingle && chat.contacts[0] == contactId {
+			return chat.info.Id
+		}
+	}
+	acc.lastChatId++
+	acc.chats[acc.lastChatId] = &chat{
+		info:     deltachat.BasicChat{Id: acc.lastChatId, ChatType: deltachat.ChatTypeSingle, Name: acc.contacts[contactId].DisplayName},
+		contacts: []uint32{contactId},
+	}
+	return acc.lastChatId
+}
+
+func (acc *account) createGroup(name string) uint32 {
+	acc.lastChatId++
+	acc.chats[acc.lastChatId] = &chat{
+		info:     deltachat.BasicChat{Id: acc.lastChatId, ChatType: deltachat.ChatTypeGroup, Name: name},
+		contacts: []uint32{deltachat.ContactSelf},
+	}
+	return acc.lastChatId
+}
+
+func (acc *account) addMsg(chatId uint32, contactId uint32, data deltachat.MessageData) *deltachat.Message {
+	acc.lastMsgId++
+	sender, _ := acc.contact(contactId)
+	now := time.Now().Unix()
+	msg := &deltachat.Message{
+		Id:                 acc.lastMsgId,
+		ChatId:             chatId,
+		FromId:             contactId,
+		Sender:             sender,
+		File:               data.File,
+		FileName:           data.Filename,
+		OverrideSenderName: data.OverrideSenderName,
+		ParentId:           data.QuotedMessageId,
+		Timestamp:          now,
+		SortTimestamp:      now,
+		ReceivedTimestamp:  now,
+		ViewType:           deltachat.ViewtypeText,
+	}
+	if data.Text != nil {
+		msg.Text = *data.Text
+	}
+	if data.Viewtype != nil {
+		msg.ViewType = *data.Viewtype
+	} else if data.File != nil {
+		msg.ViewType = deltachat.ViewtypeFile
+		if strings.HasSuffix(*data.File, ".xdc") {
+			msg.ViewType = deltachat.ViewtypeWebxdc
+		}
+	}
+	acc.msgs[msg.Id] = msg
+	acc.chats[chatId].msgs = append(acc.chats[chatId].msgs, msg.Id)
+	return msg
+}
+
+func (acc *account) chat(chatId uint32) (*chat, error) {
+	chat, ok := acc.chats[chatId]
+	if !ok {
+		return nil, fmt.Errorf("chat #%v not found", chatId)
+	}
+	return chat, nil
+}
+
+// Get the IDs of all the accounts sorted in ascending order.
+func (trans *Transport) accountIds() []uint32 {
+	accounts := make([]uint32, 0, len(trans.accounts))
+	for accId := range trans.accounts {
+		accounts = append(accounts, accId)
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i] < accounts[j] })
+	return accounts
+}
@@ -0,0 +1,129 @@
+package bottest_test
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/chatmail/rpc-client-go/v2/deltachat"
+	"github.com/deltachat-bot/deltabot-cli-go/v2/botcli"
+	"github.com/deltachat-bot/deltabot-cli-go/v2/botcli/bottest"
+	"github.com/deltachat-bot/deltabot-cli-go/v2/xdcrpc"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+type api struct{}
+
+func (api *api) Echo(text string) string {
+	return text
+}
+
+// Run the serve subcommand of the given bot using the given fake until the test ends.
+func serve(t *testing.T, cli *botcli.BotCli, fake *bottest.Transport) {
+	botChan := make(chan *deltachat.Bot, 1)
+	cli.OnBotStart(func(cli *botcli.BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string) {
+		botChan <- bot
+	})
+	cli.TransportFactory = fake.Factory
+	cli.RootCmd.SetArgs([]string{"-f=" + t.TempDir(), "--log-level=error", "serve"})
+	done := make(chan error, 1)
+	go func() { done <- cli.Start() }()
+	bot := <-botChan
+	t.Cleanup(func() {
+		bot.Stop()
+		require.Nil(t, <-done)
+	})
+}
+
+func TestTransport_ChatCommands(t *testing.T) {
+	t.Parallel()
+	fake := bottest.New()
+	accId := fake.AddAccount("bot@example.org")
+	cli := botcli.New("testbot")
+	cli.AddChatCommand("echo", "repeat the given text", func(cli *botcli.BotCli, bot *deltachat.Bot, req *botcli.ChatRequest) {
+		require.Nil(t, req.Reply(bot, req.Args[0]))
+	})
+	cli.AddChatCommand("info", "", func(cli *botcli.BotCli, bot *deltachat.Bot, req *botcli.ChatRequest) {
+		require.Nil(t, req.Reply(bot, "secret"))
+	}).Role = botcli.RoleAdmin
+	serve(t, cli, fake)
+
+	fake.ReceiveText(accId, "alice@example.org", `/echo "hello world"`)
+	msg, err := fake.NextSentMsg(accId, time.Second)
+	require.Nil(t, err)
+	require.Equal(t, "hello world", msg.Text)
+
+	fake.ReceiveText(accId, "alice@example.org", "/info")
+	msg, err = fake.NextSentMsg(accId, time.Second)
+	require.Nil(t, err)
+	require.Equal(t, "Permission denied: you are not allowed to use /info", msg.Text)
+
+	rpc := fake.Rpc()
+	adminChatId, err := cli.AdminChat(deltachat.NewBot(rpc), accId)
+	require.Nil(t, err)
+	aliceId := fake.AddContact(accId, "alice@example.org", "")
+	require.Nil(t, rpc.AddContactToChat(accId, adminChatId, aliceId))
+	fake.ReceiveText(accId, "alice@example.org", "/info")
+	msg, err = fake.NextSentMsg(accId, time.Second)
+	require.Nil(t, err)
+	require.Equal(t, "secret", msg.Text)
+
+	_, err = fake.NextSentMsg(accId, 10*time.Millisecond)
+	require.NotNil(t, err)
+	require.Len(t, fake.SentMsgs(accId), 3)
+}
+
+func TestTransport_Webxdc(t *testing.T) {
+	t.Parallel()
+	fake := bottest.New()
+	accId := fake.AddAccount("bot@example.org")
+	cli := botcli.New("testbot")
+	cli.OnBotInit(func(cli *botcli.BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string) {
+		bot.On(&deltachat.EventTypeWebxdcStatusUpdate{}, func(bot *deltachat.Bot, accId uint32, event deltachat.EventType) {
+			ev := event.(*deltachat.EventTypeWebxdcStatusUpdate)
+			_ = xdcrpc.HandleMessage(bot.Rpc, accId, ev.MsgId, ev.StatusUpdateSerial, &api{})
+		})
+	})
+	serve(t, cli, fake)
+
+	contactId := fake.AddContact(accId, "alice@example.org", "Alice")
+	chatId := fake.CreateChat(accId, contactId)
+	file := "app.xdc"
+	msgId := fake.ReceiveMsg(accId, chatId, contactId, deltachat.MessageData{File: &file})
+	msg, err := fake.Rpc().GetMessage(accId, msgId)
+	require.Nil(t, err)
+	require.Equal(t, deltachat.ViewtypeWebxdc, msg.ViewType)
+	require.Equal(t, "Alice", msg.Sender.DisplayName)
+
+	_, err = fake.ReceiveWebxdcUpdate(accId, msgId, `{"payload": {"id": "1", "method": "Echo", "params": ["hi"]}}`)
+	require.Nil(t, err)
+	require.Eventually(t, func() bool { return len(fake.WebxdcUpdates(accId, msgId)) == 2 }, time.Second, time.Millisecond)
+	var update xdcrpc.StatusUpdate[xdcrpc.Response]
+	require.Nil(t, json.Unmarshal(fake.WebxdcUpdates(accId, msgId)[1], &update))
+	require.Equal(t, "1", update.Payload.Id)
+	require.Equal(t, "hi", update.Payload.Result)
+}
+
+func TestTransport_Init(t *testing.T) {
+	t.Parallel()
+	fake := bottest.New()
+	cli := botcli.New("testbot")
+	cli.TransportFactory = fake.Factory
+	cli.RootCmd.SetArgs([]string{"-f=" + t.TempDir(), "--log-level=error", "init", "dcaccount:example.org"})
+	require.Nil(t, cli.Start())
+
+	rpc := fake.Rpc()
+	accounts, err := rpc.GetAllAccountIds()
+	require.Nil(t, err)
+	require.Equal(t, []uint32{1}, accounts)
+	isConf, err := rpc.IsConfigured(1)
+	require.Nil(t, err)
+	require.True(t, isConf)
+	addr, err := rpc.GetConfig(1, "configured_addr")
+	require.Nil(t, err)
+	require.Equal(t, "bot1@example.org", *addr)
+	bot, err := rpc.GetConfig(1, "bot")
+	require.Nil(t, err)
+	require.Equal(t, "1", *bot)
+}
@@ -0,0 +1,503 @@
+package bottest
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/chatmail/rpc-client-go/v2/deltachat"
+)
+
+// Decode the given RPC call parameters into the given targets.
+func decode(params []any, targets ...any) error {
+	if len(params) < len(targets) {
+		return fmt.Errorf("expected %v parameters, got %v", len(targets), len(params))
+	}
+	for i, target := range targets {
+		data, err := json.Marshal(params[i])
+		if err != nil {
+			return err
+		}
+		if err := json.Unmarshal(data, target); err != nil {
+			return fmt.Errorf("invalid parameter %v: %w", i, err)
+		}
+	}
+	return nil
+}
+
+// Simulate the given RPC method call.
+func (trans *Transport) call(ctx context.Context, method string, params []any) (any, error) {
+	if method == "get_next_event" {
+		return trans.nextEvent(ctx)
+	}
+
+	trans.mu.Lock()
+	defer trans.mu.Unlock()
+
+	switch method {
+	case "get_system_info":
+		return trans.SystemInfo, nil
+	case "add_account":
+		return trans.addAccount(), nil
+	case "get_all_account_ids":
+		return trans.accountIds(), nil
+	case "start_io_for_all_accounts", "stop_io_for_all_accounts":
+		return nil, nil
+	}
+
+	var accId uint32
+	if err := decode(params, &accId); err != nil {
+		return nil, err
+	}
+	acc, err := trans.getAccount(accId)
+	if err != nil {
+		return nil, err
+	}
+	args := params[1:]
+
+	switch method {
+	case "remove_account":
+		delete(trans.accounts, accId)
+		return nil, nil
+	case "start_io", "stop_io", "markseen_msgs", "accept_chat":
+		return nil, nil
+	case "is_configured":
+		return acc.addr() != "", nil
+	case "get_info":
+		return map[string]string{"configured_addr": acc.addr(), "number_of_chats": fmt.Sprint(len(acc.chats))}, nil
+	case "get_connectivity":
+		if acc.addr() == "" {
+			return connectivityNotConnected, nil
+		}
+		return connectivityConnected, nil
+
+	case "get_config":
+		var key string
+		if err := decode(args, &key); err != nil {
+			return nil, err
+		}
+		return acc.getConfig(key), nil
+	case "batch_get_config":
+		var keys []string
+		if err := decode(args, &keys); err != nil {
+			return nil, err
+		}
+		values := make(map[string]*string, len(keys))
+		for _, key := range keys {
+			values[key] = acc.getConfig(key)
+		}
+		return values, nil
+	case "set_config":
+		var key string
+		var value *string
+		if err := decode(args, &key, &value); err != nil {
+			return nil, err
+		}
+		if key == "configured_addr" && value != nil {
+			return nil, acc.setPrimaryTransport(*value)
+		}
+		acc.setConfig(key, value)
+		return nil, nil
+	case "batch_set_config":
+		var values map[string]*string
+		if err := decode(args, &values); err != nil {
+			return nil, err
+		}
+		for key, value := range values {
+			acc.setConfig(key, value)
+		}
+		return nil, nil
+
+	case "list_transports":
+		return acc.transports, nil
+	case "list_transports_ex":
+		entries := make([]deltachat.TransportListEntry, 0, len(acc.transports))
+		for _, param := range acc.transports {
+			entries = append(entries, deltachat.TransportListEntry{Param: param})
+		}
+		return entries, nil
+	case "add_or_update_transport", "add_transport":
+		var param deltachat.EnteredLoginParam
+		if err := decode(args, &param); err != nil {
+			return nil, err
+		}
+		trans.configure(accId, acc, param)
+		return nil, nil
+	case "add_transport_from_qr":
+		var qr string
+		if err := decode(args, &qr); err != nil {
+			return nil, err
+		}
+		param, err := parseLoginQr(accId, qr)
+		if err != nil {
+			return nil, err
+		}
+		trans.configure(accId, acc, param)
+		return nil, nil
+	case "delete_transport":
+		var addr string
+		if err := decode(args, &addr); err != nil {
+			return nil, err
+		}
+		return nil, acc.deleteTransport(addr)
+	case "export_backup":
+		var dir string
+		var passphrase *string
+		if err := decode(args, &dir, &passphrase); err != nil {
+			return nil, err
+		}
+		return nil, acc.exportBackup(dir, passphrase)
+	case "import_backup":
+		var path string
+		var passphrase *string
+		if err := decode(args, &path, &passphrase); err != nil {
+			return nil, err
+		}
+		return nil, acc.importBackup(path, passphrase)
+	case "get_chat_securejoin_qr_code":
+		return "https://i.delta.chat/#FAKE&a=" + url.QueryEscape(acc.addr()), nil
+
+	case "get_contact":
+		var contactId uint32
+		if err := decode(args, &contactId); err != nil {
+			return nil, err
+		}
+		return acc.contact(contactId)
+	case "create_contact":
+		var addr string
+		var name *string
+		if err := decode(args, &addr, &name); err != nil {
+			return nil, err
+		}
+		if name == nil {
+			name = new(string)
+		}
+		return acc.addContact(addr, *name), nil
+	case "lookup_contact_id_by_addr":
+		var addr string
+		if err := decode(args, &addr); err != nil {
+			return nil, err
+		}
+		for _, contact := range acc.contacts {
+			if contact.Id > deltachat.ContactLastSpecial && strings.EqualFold(contact.Address, addr) {
+				return &contact.Id, nil
+			}
+		}
+		return nil, nil
+
+	case "create_chat_by_contact_id", "get_chat_id_by_contact_id":
+		var contactId uint32
+		if err := decode(args, &contactId); err != nil {
+			return nil, err
+		}
+		if _, err := acc.contact(contactId); err != nil {
+			return nil, err
+		}
+		return acc.createChat(contactId), nil
+	case "create_group_chat":
+		var name string
+		if err := decode(args, &name); err != nil {
+			return nil, err
+		}
+		return acc.createGroup(name), nil
+	case "add_contact_to_chat", "remove_contact_from_chat":
+		var chatId, contactId uint32
+		if err := decode(args, &chatId, &contactId); err != nil {
+			return nil, err
+		}
+		chat, err := acc.chat(chatId)
+		if err != nil {
+			return nil, err
+		}
+		chat.contacts = removeId(chat.contacts, contactId)
+		if method == "add_contact_to_chat" {
+			chat.contacts = append(chat.contacts, contactId)
+		}
+		return nil, nil
+	case "set_chat_name":
+		var chatId uint32
+		var name string
+		if err := decode(args, &chatId, &name); err != nil {
+			return nil, err
+		}
+		chat, err := acc.chat(chatId)
+		if err != nil {
+			return nil, err
+		}
+		chat.info.Name = name
+		return nil, nil
+	}
+
+	var chatOrMsgId uint32
+	if err := decode(args, &chatOrMsgId); err != nil {
+		return nil, err
+	}
+	args = args[1:]
+
+	switch method {
+	case "get_chat_contacts":
+		chat, err := acc.chat(chatOrMsgId)
+		if err != nil {
+			return nil, err
+		}
+		return chat.contacts, nil
+	case "can_send":
+		chat, err := acc.chat(chatOrMsgId)
+		if err != nil {
+			return nil, err
+		}
+		return chat.canSend(), nil
+	case "get_basic_chat_info":
+		chat, err := acc.chat(chatOrMsgId)
+		if err != nil {
+			return nil, err
+		}
+		return chat.info, nil
+	case "get_full_chat_by_id":
+		chat, err := acc.chat(chatOrMsgId)
+		if err != nil {
+			return nil, err
+		}
+		return deltachat.FullChat{
+			Id:          chat.info.Id,
+			ChatType:    chat.info.ChatType,
+			Name:        chat.info.Name,
+			ContactIds:  chat.contacts,
+			CanSend:     chat.canSend(),
+			SelfInGroup: chat.canSend(),
+		}, nil
+	case "get_message_ids":
+		chat, err := acc.chat(chatOrMsgId)
+		if err != nil {
+			return nil, err
+		}
+		return chat.msgs, nil
+	case "send_msg":
+		var data deltachat.MessageData
+		if err := decode(args, &data); err != nil {
+			return nil, err
+		}
+		return trans.sendMsg(acc, chatOrMsgId, data)
+	case "misc_send_text_message":
+		var text string
+		if err := decode(args, &text); err != nil {
+			return nil, err
+		}
+		return trans.sendMsg(acc, chatOrMsgId, deltachat.MessageData{Text: &text})
+
+	case "get_message":
+		msg, ok := acc.msgs[chatOrMsgId]
+		if !ok {
+			return nil, fmt.Errorf("message #%v not found", chatOrMsgId)
+		}
+		return msg, nil
+	case "send_webxdc_status_update":
+		var update string
+		if err := decode(args, &update); err != nil {
+			return nil, err
+		}
+		_, err := trans.addWebxdcUpdate(acc, accId, chatOrMsgId, update)
+		return nil, err
+	case "get_webxdc_status_updates":
+		var lastKnownSerial uint32
+		if err := decode(args, &lastKnownSerial); err != nil {
+			return nil, err
+		}
+		return acc.webxdcUpdates(chatOrMsgId, lastKnownSerial)
+	}
+
+	return nil, fmt.Errorf("method %q not supported by the fake RPC server", method)
+}
+
+// Simulate the configuration of the given account with the given login parameters.
+func (trans *Transport) configure(accId uint32, acc *account, param deltachat.EnteredLoginParam) {
+	trans.emit(accId, &deltachat.EventTypeConfigureProgress{Progress: 500})
+	acc.transports = append(removeTransport(acc.transports, param.Addr), param)
+	trans.emit(accId, &deltachat.EventTypeConfigureProgress{Progress: 1000})
+}
+
+func (trans *Transport) sendMsg(acc *account, chatId uint32, data deltachat.MessageData) (uint32, error) {
+	chat, err := acc.chat(chatId)
+	if err != nil {
+		return 0, err
+	}
+	if !chat.canSend() {
+		return 0, fmt.Errorf("can't send messages to chat #%v", chatId)
+	}
+	msg := acc.addMsg(chatId, deltachat.ContactSelf, data)
+	acc.outgoing = append(acc.outgoing, msg.Id)
+	trans.notify()
+	return msg.Id, nil
+}
+
+// Get a login parameter from a dcaccount: or dclogin: QR code.
+func parseLoginQr(accId uint32, qr string) (deltachat.EnteredLoginParam, error) {
+	if domain, ok := strings.CutPrefix(qr, "dcaccount:"); ok {
+		domain = strings.TrimPrefix(strings.TrimPrefix(domain, "https://"), "//")
+		domain, _, _ = strings.Cut(domain, "/")
+		if domain == "" {
+			return deltachat.EnteredLoginParam{}, fmt.Errorf("invalid QR code: %v", qr)
+		}
+		return deltachat.EnteredLoginParam{Addr: fmt.Sprintf("bot%v@%v", accId, domain)}, nil
+	}
+	if login, ok := strings.CutPrefix(qr, "dclogin:"); ok {
+		login = strings.TrimPrefix(login, "//")
+		addr, query, _ := strings.Cut(login, "?")
+		values, _ := url.ParseQuery(query)
+		if !strings.Contains(addr, "@") {
+			return deltachat.EnteredLoginParam{}, fmt.Errorf("invalid QR code: %v", qr)
+		}
+		return deltachat.EnteredLoginParam{Addr: addr, Password: values.Get("p")}, nil
+	}
+	return deltachat.EnteredLoginParam{}, fmt.Errorf("unsupported QR code: %v", qr)
+}
+
+func (acc *account) getConfig(key string) *string {
+	if key == "addr" || key == "configured_addr" {
+		if addr := acc.addr(); addr != "" {
+			return &addr
+		}
+		return nil
+	}
+	if value, ok := acc.config[key]; ok {
+		return &value
+	}
+	return nil
+}
+
+func (acc *account) setConfig(key string, value *string) {
+	if value == nil {
+		delete(acc.config, key)
+	} else {
+		acc.config[key] = *value
+	}
+}
+
+func (acc *account) deleteTransport(addr string) error {
+	if len(acc.transports) != 0 && strings.EqualFold(acc.transports[0].Addr, addr) {
+		return fmt.Errorf("can't delete the primary transport %v", addr)
+	}
+	transports := removeTransport(acc.transports, addr)
+	if len(transports) == len(acc.transports) {
+		return fmt.Errorf("transport %v not found", addr)
+	}
+	acc.transports = transports
+	return nil
+}
+
+// Simulated backup file, only the login parameters and the configuration of the account are saved.
+type backup struct {
+	Passphrase string                        `json:"passphrase,omitempty"`
+	Transports []deltachat.EnteredLoginParam `json:"transports"`
+	Config     map[string]string             `json:"config"`
+}
+
+func (acc *account) exportBackup(dir string, passphrase *string) error {
+	if acc.addr() == "" {
+		return errors.New("can't export backup, account not configured")
+	}
+	data := backup{Transports: acc.transports, Config: acc.config}
+	if passphrase != nil {
+		data.Passphrase = *passphrase
+	}
+	content, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+	name := fmt.Sprintf("delta-chat-backup-%v-%v.tar", time.Now().Format("2006-01-02"), acc.addr())
+	return os.WriteFile(filepath.Join(dir, name), content, 0600)
+}
+
+func (acc *account) importBackup(path string, passphrase *string) error {
+	if acc.addr() != "" {
+		return errors.New("can't import backup into a configured account")
+	}
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+	var data backup
+	if err := json.Unmarshal(content, &data); err != nil {
+		return fmt.Errorf("invalid backup file: %w", err)
+	}
+	if passphrase == nil {
+		passphrase = new(string)
+	}
+	if data.Passphrase != *passphrase {
+		return errors.New("wrong backup passphrase")
+	}
+	acc.transports = data.Transports
+	for key, value := range data.Config {
+		acc.config[key] = value
+	}
+	return nil
+}
+
+// Make the transport with the given address the primary transport, as core does when "configured_addr" is set.
+func (acc *account) setPrimaryTransport(addr string) error {
+	for i, param := range acc.transports {
+		if strings.EqualFold(param.Addr, addr) {
+			acc.transports = append([]deltachat.EnteredLoginParam{param}, append(acc.transports[:i:i], acc.transports[i+1:]...)...)
+			return nil
+		}
+	}
+	return fmt.Errorf("transport %v not found", addr)
+}
+
+// Get the status updates of the given webxdc message with serial greater than the given serial, as a JSON array.
+func (acc *account) webxdcUpdates(msgId uint32, lastKnownSerial uint32) (string, error) {
+	if _, ok := acc.msgs[msgId]; !ok {
+		return "", fmt.Errorf("message #%v not found", msgId)
+	}
+	updates := []map[string]json.RawMessage{}
+	for _, update := range acc.updates[msgId] {
+		var serial uint32
+		_ = json.Unmarshal(update["serial"], &serial)
+		if serial > lastKnownSerial {
+			copied := make(map[string]json.RawMessage, len(update)+1)
+			for key, value := range update {
+				copied[key] = value
+			}
+			copied["max_serial"], _ = json.Marshal(acc.lastSerial)
+			updates = append(updates, copied)
+		}
+	}
+	data, err := json.Marshal(updates)
+	return string(data), err
+}
+
+// Returns true if the bot is a member of the chat.
+func (chat *chat) canSend() bool {
+	for _, contactId := range chat.contacts {
+		if contactId == deltachat.ContactSelf {
+			return true
+		}
+	}
+	return chat.info.ChatType == deltachat.ChatTypeSingle
+}
+
+func removeId(ids []uint32, id uint32) []uint32 {
+	result := make([]uint32, 0, len(ids))
+	for _, item := range ids {
+		if item != id {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+func removeTransport(transports []deltachat.EnteredLoginParam, addr string) []deltachat.EnteredLoginParam {
+	result := make([]deltachat.EnteredLoginParam, 0, len(transports))
+	for _, param := range transports {
+		if !strings.EqualFold(param.Addr, addr) {
+			result = append(result, param)
+		}
+	}
+	return result
+}
@@ -0,0 +1,232 @@
+package botcli
+
+import (
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/chatmail/rpc-client-go/v2/deltachat"
+	"go.uber.org/zap"
+)
+
+// A function that can be used as handler in AddChatCommand().
+type ChatCommandHandler func(cli *BotCli, bot *deltachat.Bot, req *ChatRequest)
+
+// A function that can be used as handler in OnNewMsg(). The given logger has the account, chat,
+// message and sender contact of the message as context.
+type MsgHandler func(cli *BotCli, bot *deltachat.Bot, accId uint32, msg *deltachat.Message, logger *zap.SugaredLogger)
+
+// A chat command that users can send to the bot, ex. "/info".
+type ChatCommand struct {
+	// Name of the command without the leading slash
+	Name string
+	// Short description of the command, displayed in /help
+	Description string
+	// Role required to use the command, RolePublic by default
+	Role    string
+	Handler ChatCommandHandler
+	// true for the chat commands provided by this package
+	builtin bool
+}
+
+// A chat command received by the bot.
+type ChatRequest struct {
+	AccId uint32
+	// The message containing the command
+	Msg *deltachat.Message
+	// Name of the command without the leading slash
+	Command string
+	// Arguments passed to the command, double quotes can be used to pass arguments containing spaces
+	Args []string
+	// Logger with the account, chat, message, sender contact and command of the request as context
+	Logger *zap.SugaredLogger
+}
+
+// Register a chat command. The given handler will be called when a user sends a message
+// starting with "/<name>" to the bot. The description is used in the auto-generated /help message.
+//
+// By default anybody can use the command, to restrict it set the Role of the returned ChatCommand.
+func (botcli *BotCli) AddChatCommand(name string, description string, handler ChatCommandHandler) *ChatCommand {
+	name = strings.TrimPrefix(name, "/")
+	if name == "" || strings.ContainsFunc(name, func(r rune) bool { return unicode.IsSpace(r) || r == '@' }) {
+		panic("Invalid chat command name: " + name)
+	}
+	chatCmd := &ChatCommand{Name: name, Description: description, Handler: handler}
+	botcli.chatCmds[name] = chatCmd
+	return chatCmd
+}
+
+// Register a chat command provided by this package, see AddChatCommand().
+func (botcli *BotCli) addBuiltinChatCmd(name string, description string, handler ChatCommandHandler) *ChatCommand {
+	chatCmd := botcli.AddChatCommand(name, description, handler)
+	chatCmd.builtin = true
+	return chatCmd
+}
+
+// Returns true if chat commands were registered with AddChatCommand(), not counting the built-in commands.
+func (botcli *BotCli) hasCustomChatCmds() bool {
+	for _, chatCmd := range botcli.chatCmds {
+		if !chatCmd.builtin {
+			return true
+		}
+	}
+	return false
+}
+
+// Register function to be called for incoming messages that are not chat commands.
+// If chat commands are registered with AddChatCommand(), use this instead of Bot.OnNewMsg()
+// otherwise the chat commands will not be processed. Unlike Bot.OnNewMsg(), panics in the
+// handler are recovered and logged without stopping the bot.
+func (botcli *BotCli) OnNewMsg(handler MsgHandler) {
+	botcli.onNewMsg = handler
+}
+
+// Get the /help message listing the registered chat commands the given contact is allowed to use.
+func (botcli *BotCli) ChatCommandsHelp(bot *deltachat.Bot, accId uint32, contactId uint32) string {
+	cmds := []*ChatCommand{{Name: "help", Description: "show this help message"}}
+	for _, chatCmd := range botcli.chatCmds {
+		if chatCmd.Name != "help" && botcli.canUse(bot, accId, contactId, chatCmd) {
+			cmds = append(cmds, chatCmd)
+		}
+	}
+	sort.Slice(cmds, func(i, j int) bool { return cmds[i].Name < cmds[j].Name })
+
+	text := "Available commands:\n"
+	for _, chatCmd := range cmds {
+		text += "\n/" + chatCmd.Name
+		if chatCmd.Description != "" {
+			text += " - " + chatCmd.Description
+		}
+	}
+	return text
+}
+
+// Send a text message in reply to the given chat command.
+func (req *ChatRequest) Reply(bot *deltachat.Bot, text string) error {
+	_, err := bot.Rpc.SendMsg(req.AccId, req.Msg.ChatId, deltachat.MessageData{Text: &text})
+	return err
+}
+
+// NewMsgHandler used if chat commands or an OnNewMsg() handler are registered.
+func (botcli *BotCli) onNewMsgRouter(bot *deltachat.Bot, accId uint32, msgId uint32) {
+	logger := botcli.GetLogger(accId)
+	msg, err := bot.Rpc.GetMessage(accId, msgId)
+	if err != nil {
+		logger.Error(err)
+		return
+	}
+
+	name, addr, args, ok := parseChatCommand(msg.Text)
+	if !ok {
+		if botcli.onNewMsg != nil {
+			logger = botcli.MsgLogger(accId, &msg)
+			botcli.runHandler(bot, accId, logger, "message", func() { botcli.onNewMsg(botcli, bot, accId, &msg, logger) })
+		}
+		return
+	}
+	if msg.FromId <= deltachat.ContactLastSpecial || msg.IsInfo {
+		return
+	}
+	if addr != "" && !isSelfAddr(bot, accId, addr) { // command addressed to other bot
+		return
+	}
+
+	req := &ChatRequest{AccId: accId, Msg: &msg, Command: name, Args: args}
+	req.Logger = botcli.MsgLogger(accId, &msg).With("cmd", name)
+	logger = req.Logger
+	logger.Debugf("Chat command received: /%v", name)
+	chatCmd, ok := botcli.chatCmds[name]
+	switch {
+	case ok && botcli.canUse(bot, accId, msg.FromId, chatCmd):
+		botcli.runHandler(bot, accId, logger, "/"+name, func() { chatCmd.Handler(botcli, bot, req) })
+	case ok:
+		err = req.Reply(bot, "Permission denied: you are not allowed to use /"+name)
+	case !botcli.hasCustomChatCmds(): // only built-in commands, the bot doesn't use chat commands
+		if botcli.onNewMsg != nil {
+			botcli.runHandler(bot, accId, logger, "message", func() { botcli.onNewMsg(botcli, bot, accId, &msg, logger) })
+		}
+	case name == "help":
+		err = req.Reply(bot, botcli.ChatCommandsHelp(bot, accId, msg.FromId))
+	default:
+		err = req.Reply(bot, "Unknown command: /"+name+"\n\n"+botcli.ChatCommandsHelp(bot, accId, msg.FromId))
+	}
+	if err != nil {
+		logger.Error(err)
+	}
+}
+
+// Returns true if the given contact has the role required to use the given command.
+func (botcli *BotCli) canUse(bot *deltachat.Bot, accId uint32, contactId uint32, chatCmd *ChatCommand) bool {
+	allowed, err := botcli.HasRole(bot, accId, contactId, chatCmd.Role)
+	if err != nil {
+		botcli.GetLogger(accId).Errorf("Failed to check role %q: %v", chatCmd.Role, err)
+	}
+	return allowed
+}
+
+// Returns true if the given address is one of the addresses of the given account.
+func isSelfAddr(bot *deltachat.Bot, accId uint32, addr string) bool {
+	relays, err := bot.Rpc.ListTransports(accId)
+	if err != nil {
+		return false
+	}
+	for _, relay := range relays {
+		if strings.EqualFold(relay.Addr, addr) {
+			return true
+		}
+	}
+	return false
+}
+
+// Parse a chat command in the form: /cmd[@botaddr] [arg1 "quoted arg2" ...]
+func parseChatCommand(text string) (name string, addr string, args []string, ok bool) {
+	text, found := strings.CutPrefix(text, "/")
+	if !found || text == "" || strings.HasPrefix(text, "\"") || unicode.IsSpace([]rune(text)[0]) {
+		return "", "", nil, false
+	}
+	args = splitArgs(text)
+	name, addr, _ = strings.Cut(args[0], "@")
+	if name == "" || strings.Contains(name, "/") {
+		return "", "", nil, false
+	}
+	return name, addr, args[1:], true
+}
+
+// Split the given text in whitespace-separated arguments, double quotes can be used
+// to group words in a single argument, inside double quotes \" and \\ escape sequences are supported.
+func splitArgs(text string) []string {
+	args := []string{}
+	var arg strings.Builder
+	inArg, quoted, escaped := false, false, false
+	for _, char := range text {
+		switch {
+		case escaped:
+			if char != '"' && char != '\\' {
+				arg.WriteRune('\\')
+			}
+			arg.WriteRune(char)
+			escaped = false
+		case quoted && char == '\\':
+			escaped = true
+		case char == '"':
+			quoted = !quoted
+			inArg = true
+		case !quoted && unicode.IsSpace(char):
+			if inArg {
+				args = append(args, arg.String())
+				arg.Reset()
+				inArg = false
+			}
+		default:
+			arg.WriteRune(char)
+			inArg = true
+		}
+	}
+	if escaped {
+		arg.WriteRune('\\')
+	}
+	if inArg {
+		args = append(args, arg.String())
+	}
+	return args
+}
@@ -0,0 +1,95 @@
+package botcli
+
+import (
+	"testing"
+
+	"github.com/chatmail/rpc-client-go/v2/deltachat"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParseChatCommand(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		text string
+		name string
+		addr string
+		args []string
+		ok   bool
+	}{
+		{"hello", "", "", nil, false},
+		{"/", "", "", nil, false},
+		{"/ help", "", "", nil, false},
+		{"/usr/bin", "", "", nil, false},
+		{"/help", "help", "", []string{}, true},
+		{"/help@bot@example.org", "help", "bot@example.org", []string{}, true},
+		{"/echo  one two", "echo", "", []string{"one", "two"}, true},
+		{`/echo "one two" three`, "echo", "", []string{"one two", "three"}, true},
+		{`/echo "say \"hi\"" ""`, "echo", "", []string{`say "hi"`, ""}, true},
+		{"/echo don't\nstop", "echo", "", []string{"don't", "stop"}, true},
+	}
+	for _, test := range tests {
+		name, addr, args, ok := parseChatCommand(test.text)
+		require.Equal(t, test.ok, ok, test.text)
+		require.Equal(t, test.name, name, test.text)
+		require.Equal(t, test.addr, addr, test.text)
+		require.Equal(t, test.args, args, test.text)
+	}
+}
+
+func TestBotCli_ChatCommandsHelp(t *testing.T) {
+	t.Parallel()
+	cli := New("testbot")
+	delete(cli.chatCmds, logLevelCmd) // checking the admin role of the built-in command needs a bot
+	cli.AddChatCommand("/info", "show info", func(cli *BotCli, bot *deltachat.Bot, req *ChatRequest) {})
+	cli.AddChatCommand("about", "", func(cli *BotCli, bot *deltachat.Bot, req *ChatRequest) {})
+	cli.AddChatCommand("ban", "ban user", func(cli *BotCli, bot *deltachat.Bot, req *ChatRequest) {}).Role = "moderator"
+	cli.AddRole("moderator", func(cli *BotCli, bot *deltachat.Bot, accId uint32, contactId uint32) (bool, error) {
+		return contactId == 10, nil
+	})
+	require.Equal(t, "Available commands:\n\n/about\n/help - show this help message\n/info - show info", cli.ChatCommandsHelp(nil, 1, 11))
+	require.Equal(t, "Available commands:\n\n/about\n/ban - ban user\n/help - show this help message\n/info - show info", cli.ChatCommandsHelp(nil, 1, 10))
+	require.Panics(t, func() {
+		cli.AddChatCommand("bad name", "", func(cli *BotCli, bot *deltachat.Bot, req *ChatRequest) {})
+	})
+}
+
+func TestBotCli_AddChatCommand(t *testing.T) {
+	t.Parallel()
+	cli := New("testbot")
+	var cliBot *deltachat.Bot
+	cli.OnBotInit(func(cli *BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string) {
+		cliBot = bot
+	})
+	cli.AddChatCommand("echo", "repeat the given text", func(cli *BotCli, bot *deltachat.Bot, req *ChatRequest) {
+		require.Nil(t, req.Reply(bot, req.Args[0]))
+	})
+	cli.AddChatCommand("info", "", func(cli *BotCli, bot *deltachat.Bot, req *ChatRequest) {
+		require.Nil(t, req.Reply(bot, "secret"))
+	}).Role = RoleAdmin
+	go RunConfiguredCli(cli, "serve") //nolint:errcheck
+	for cliBot == nil || !cliBot.IsRunning() {
+	}
+	defer cliBot.Stop()
+
+	acfactory.WithOnlineAccount(func(rpc *deltachat.Rpc, accId uint32) {
+		chatWithBot := acfactory.CreateChat(rpc, accId, cliBot.Rpc, 1)
+
+		_, err := rpc.MiscSendTextMessage(accId, chatWithBot, `/echo "hello world"`)
+		require.Nil(t, err)
+		msg := acfactory.NextMsg(rpc, accId)
+		require.Equal(t, "hello world", msg.Text)
+
+		_, err = rpc.MiscSendTextMessage(accId, chatWithBot, "/unknown")
+		require.Nil(t, err)
+		msg = acfactory.NextMsg(rpc, accId)
+		require.Contains(t, msg.Text, "Unknown command: /unknown")
+		require.Contains(t, msg.Text, "/echo - repeat the given text")
+		require.NotContains(t, msg.Text, "/info")
+
+		_, err = rpc.MiscSendTextMessage(accId, chatWithBot, "/info")
+		require.Nil(t, err)
+		msg = acfactory.NextMsg(rpc, accId)
+		require.Equal(t, "Permission denied: you are not allowed to use /info", msg.Text)
+	})
+}
@@ -1,8 +1,13 @@
 package botcli
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
+	"os"
+	"slices"
 	"strings"
+	"time"
 
 	"github.com/chatmail/rpc-client-go/v2/deltachat"
 	"github.com/spf13/cobra"
@@ -11,49 +16,70 @@ import (
 func initializeRootCmd(cli *BotCli) {
 	defDir := getDefaultAppDir(cli.AppName)
 	cli.RootCmd.PersistentFlags().StringVarP(&cli.AppDir, "folder", "f", defDir, "program's data folder")
-	cli.RootCmd.PersistentFlags().Uint32VarP(&cli.SelectedAccount, "account", "a", 0, "operate over this account ID only when running any subcommand")
+	cli.RootCmd.PersistentFlags().StringVarP(&cli.accountSelector, "account", "a", "", "operate over this account only when running any subcommand, the account can be given by its ID or by its address")
+	cli.RootCmd.PersistentFlags().StringVar(&cli.OutputFormat, "output", OutputText, "output format of the built-in subcommands: text or json")
+	cli.RootCmd.PersistentFlags().StringVar(&cli.logOpts.level, "log-level", "debug", "minimum level of the logged messages: debug, info, warn or error, if not set the level saved by bot administrators with the /loglevel chat command is used")
+	cli.RootCmd.PersistentFlags().StringVar(&cli.logOpts.format, "log-format", "console", "format of the logged messages: console or json")
+	cli.RootCmd.PersistentFlags().StringVar(&cli.logOpts.file, "log-file", "", "write logs to this file instead of stderr, the file is rotated when it reaches --log-max-size")
+	cli.RootCmd.PersistentFlags().IntVar(&cli.logOpts.maxSize, "log-max-size", 100, "maximum size in megabytes of the log file before it gets rotated")
+	cli.RootCmd.PersistentFlags().IntVar(&cli.logOpts.maxBackups, "log-max-backups", 5, "maximum number of rotated log files to keep")
+	cli.RootCmd.PersistentFlags().StringVar(&cli.RpcServerPath, "rpc-server", "deltachat-rpc-server", "path of the deltachat-rpc-server program, by default it is searched in PATH")
+	cli.RootCmd.PersistentFlags().StringSliceVar(&cli.RpcServerEnv, "rpc-server-env", nil, "extra environment variables for the deltachat-rpc-server program in the form KEY=VALUE, ex. RUST_LOG=info")
+	cli.RootCmd.PersistentFlags().StringVar(&cli.RpcSocket, "rpc-socket", "", "connect to an already running RPC server at this address instead of starting deltachat-rpc-server, ex. unix:/run/bot/rpc.sock or tcp:127.0.0.1:4000")
+	cli.RootCmd.PersistentFlags().BoolVar(&cli.AllowVersionMismatch, "allow-version-mismatch", false, "run even if the version of deltachat-rpc-server does not match the version this program was built against")
 
 	initCmd := &cobra.Command{
 		Use:   "init",
 		Short: "do initial login configuration of a new Delta Chat account. If only one argument is given it must be a configuration URI (ex. dcaccount:)",
 		Args:  cobra.RangeArgs(1, 2),
 	}
-	cli.AddCommand(initCmd, initCallback)
+	cli.AddCommandE(initCmd, initCallback)
 
 	listCmd := &cobra.Command{
 		Use:   "list",
 		Short: "show a list of existing bot accounts",
 		Args:  cobra.ExactArgs(0),
 	}
-	cli.AddCommand(listCmd, listCallback)
+	cli.AddCommandE(listCmd, listCallback)
 
 	removeCmd := &cobra.Command{
 		Use:   "remove",
-		Short: "remove Delta Chat accounts from the bot",
-		Args:  cobra.ExactArgs(0),
+		Short: "remove Delta Chat accounts from the bot, the accounts can be given as arguments by ID or address",
+		Args:  cobra.ArbitraryArgs,
 	}
-	cli.AddCommand(removeCmd, removeCallback)
+	removeCmd.Flags().BoolP("yes", "y", false, "don't ask for confirmation before removing the accounts")
+	removeCmd.Flags().Bool("dry-run", false, "only show the accounts that would be removed")
+	removeCmd.Flags().String("backup-dir", "", "save a backup of the accounts to this folder before removing them, accounts that are not configured are only removed without a backup with --yes")
+	addPassphraseFlags(removeCmd, "protect the backups with the passphrase")
+	cli.AddCommandE(removeCmd, removeCallback)
 
 	configCmd := &cobra.Command{
 		Use:   "config",
 		Short: "set/get account configuration values",
 		Args:  cobra.MaximumNArgs(2),
 	}
-	cli.AddCommand(configCmd, configCallback)
+	cli.AddCommandE(configCmd, configCallback)
 
 	serveCmd := &cobra.Command{
 		Use:   "serve",
 		Short: "start processing messages",
 		Args:  cobra.ExactArgs(0),
 	}
-	cli.AddCommand(serveCmd, serveCallback)
+	serveCmd.Flags().String("metrics-addr", "", "expose Prometheus metrics over HTTP at the given address, ex. 127.0.0.1:9090")
+	serveCmd.Flags().String("health-addr", "", "serve the /healthz and /readyz endpoints over HTTP at the given address, ex. 127.0.0.1:8080")
+	serveCmd.Flags().String("backup-dir", "", "periodically save backups of the accounts to this folder while serving")
+	serveCmd.Flags().Duration("backup-interval", 24*time.Hour, "time between scheduled backups, used with --backup-dir")
+	serveCmd.Flags().Int("backup-keep", 7, "number of scheduled backups to keep for each account, older backups are removed, 0 keeps all of them")
+	addPassphraseFlags(serveCmd, "protect the scheduled backups with the passphrase")
+	cli.AddCommandE(serveCmd, serveCallback)
+	cli.serveCmd = serveCmd
 
 	qrCmd := &cobra.Command{
 		Use:   "link",
 		Short: "print the bot's chat invitation link",
 		Args:  cobra.ExactArgs(0),
 	}
-	cli.AddCommand(qrCmd, qrCallback)
+	cli.AddCommandE(qrCmd, qrCallback)
 
 	adminCmd := &cobra.Command{
 		Use:   "admin",
@@ -61,15 +87,41 @@ func initializeRootCmd(cli *BotCli) {
 		Args:  cobra.ExactArgs(0),
 	}
 	adminCmd.Flags().BoolP("reset", "r", false, "reset admin chat, removes all existing admins")
-	cli.AddCommand(adminCmd, adminCallback)
-}
+	cli.AddCommandE(adminCmd, adminCallback)
 
-func initCallback(cli *BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string) {
-	bot.On(&deltachat.EventTypeConfigureProgress{}, func(bot *deltachat.Bot, accId uint32, event deltachat.EventType) {
-		ev := event.(*deltachat.EventTypeConfigureProgress)
-		cli.Logger.Infof("[account #%v] Configuration progress: %v", accId, ev.Progress)
-	})
+	exportCmd := &cobra.Command{
+		Use:   "export DIR",
+		Short: "export backups of the bot accounts to the given folder as timestamped tar files",
+		Args:  cobra.ExactArgs(1),
+	}
+	addPassphraseFlags(exportCmd, "protect the backups with the passphrase")
+	cli.AddCommandE(exportCmd, exportCallback)
+
+	importCmd := &cobra.Command{
+		Use:   "import FILE...",
+		Short: "restore the given backup files as new bot accounts",
+		Args:  cobra.MinimumNArgs(1),
+	}
+	addPassphraseFlags(importCmd, "decrypt the backups with the passphrase")
+	cli.AddCommandE(importCmd, importCallback)
+
+	relayCmd := &cobra.Command{
+		Use:   "relay",
+		Short: "manage the relays (email servers) used by the bot accounts",
+	}
+	cli.RootCmd.AddCommand(relayCmd)
+	initializeRelayCmd(cli, relayCmd)
 
+	rolesCmd := &cobra.Command{
+		Use:   "roles",
+		Short: "get the invitation links to the groups of the bot roles, if a role is given only that role is shown. WARNING: don't share these links",
+		Args:  cobra.MaximumNArgs(1),
+	}
+	rolesCmd.Flags().BoolP("reset", "r", false, "reset the group of the given role, removes all existing members from the role")
+	cli.AddCommandE(rolesCmd, rolesCallback)
+}
+
+func initCallback(cli *BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string) error {
 	var accId uint32
 	var err error
 	if cli.SelectedAccount == 0 { // create a new account
@@ -82,96 +134,81 @@ func initCallback(cli *BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []st
 		botFlag := "1"
 		err = bot.Rpc.SetConfig(accId, "bot", &botFlag)
 	}
-
+	if err == nil {
+		err = addRelay(cli, bot, accId, args)
+	}
 	if err != nil {
-		cli.Logger.Errorf("Configuration failed: %v", err)
-		return
+		return fmt.Errorf("configuration failed: %w", err)
 	}
+	cli.Logger.Infof("Account configured successfully.")
 
-	go func() {
-		if len(args) == 2 {
-			params := deltachat.EnteredLoginParam{Addr: args[0], Password: args[1]}
-			err = bot.Rpc.AddOrUpdateTransport(accId, params)
-		} else {
-			err = bot.Rpc.AddTransportFromQr(accId, args[0])
-		}
-		if err != nil {
-			cli.Logger.Errorf("Configuration failed: %v", err)
-		} else {
-			cli.Logger.Infof("Account configured successfully.")
-		}
-		bot.Stop()
-	}()
-	bot.Run() //nolint:errcheck
+	if cli.OutputFormat != OutputJson {
+		return nil
+	}
+	outputs, _ := forEachAccount([]uint32{accId}, func(out *accountOutput) error {
+		return listForAcc(cli, bot, out)
+	})
+	return printOutputs(cli, cmd, outputs, false)
 }
 
-func configCallback(cli *BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string) {
-	var err error
-	var accounts []uint32
-	if cli.SelectedAccount == 0 { // set config for all accounts
-		accounts, err = bot.Rpc.GetAllAccountIds()
-	} else {
-		accounts = []uint32{cli.SelectedAccount}
-	}
+func configCallback(cli *BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string) error {
+	accounts, err := selectedAccounts(cli, bot)
 	if err != nil {
-		cli.Logger.Error(err)
-		return
-	}
-
-	for _, accId := range accounts {
-		fmt.Printf("Account #%v:\n", accId)
-		configForAcc(cli, bot, cmd, args, accId)
-		fmt.Println("")
+		return err
 	}
 
-	if len(accounts) == 0 {
-		cli.Logger.Errorf("There are no accounts yet, add a new account using the init subcommand")
-	}
+	outputs, err := forEachAccount(accounts, func(out *accountOutput) error {
+		return configForAcc(cli, bot, cmd, args, out)
+	})
+	return errors.Join(printOutputs(cli, cmd, outputs, true), err)
 }
 
-func configForAcc(cli *BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string, accId uint32) {
+func configForAcc(cli *BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string, out *accountOutput) error {
+	out.Configured, _ = bot.Rpc.IsConfigured(out.Id)
+	out.Config = make(map[string]string)
 	if len(args) == 0 {
-		keys, _ := bot.Rpc.GetConfig(accId, "sys.config_keys")
+		keys, err := bot.Rpc.GetConfig(out.Id, "sys.config_keys")
+		if err != nil {
+			return err
+		}
 		for _, key := range strings.Fields(*keys) {
-			val, _ := bot.Rpc.GetConfig(accId, key)
+			val, _ := bot.Rpc.GetConfig(out.Id, key)
 			var strval string
 			if val != nil {
 				strval = *val
 			}
-			fmt.Printf("%v=%q\n", key, strval)
+			out.Config[key] = strval
+			out.text = append(out.text, fmt.Sprintf("%v=%q", key, strval))
 		}
-		return
+		return nil
 	}
 
-	var val *string
-	var err error
 	if len(args) == 2 {
-		err = bot.Rpc.SetConfig(accId, args[0], &args[1])
+		if err := bot.Rpc.SetConfig(out.Id, args[0], &args[1]); err != nil {
+			return err
+		}
 	}
-	if err == nil {
-		val, err = bot.Rpc.GetConfig(accId, args[0])
+	val, err := bot.Rpc.GetConfig(out.Id, args[0])
+	if err != nil {
+		return err
 	}
-	if err == nil {
-		var strval string
-		if val != nil {
-			strval = *val
-		}
-		fmt.Printf("%v=%v\n", args[0], strval)
-	} else {
-		cli.Logger.Error(err)
+	var strval string
+	if val != nil {
+		strval = *val
 	}
+	out.Config[args[0]] = strval
+	out.text = append(out.text, fmt.Sprintf("%v=%v", args[0], strval))
+	return nil
 }
 
-func serveCallback(cli *BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string) {
+func serveCallback(cli *BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string) error {
 	if cli.SelectedAccount != 0 {
-		cli.Logger.Errorf("operation not supported for a single account, discard the -a/--account option and try again")
-		return
+		return errSingleAccount
 	}
 
 	accounts, err := bot.Rpc.GetAllAccountIds()
 	if err != nil {
-		cli.Logger.Error(err)
-		return
+		return err
 	}
 	var inviteLinks []string
 	for _, accId := range accounts {
@@ -182,171 +219,331 @@ func serveCallback(cli *BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []s
 			inviteLinks = append(inviteLinks, inviteLink)
 		}
 	}
-	if len(inviteLinks) != 0 {
-		cli.Logger.Infof("Listening at: %v", strings.Join(inviteLinks, "\n"))
-		if cli.onStart != nil {
-			cli.onStart(cli, bot, cmd, args)
+	if len(inviteLinks) == 0 {
+		return errors.New("there are no configured accounts to serve")
+	}
+
+	if addr, _ := cmd.Flags().GetString("metrics-addr"); addr != "" {
+		stopMetrics, err := cli.startMetrics(bot, addr)
+		if err != nil {
+			return err
 		}
-		bot.Run() //nolint:errcheck
-	} else {
-		cli.Logger.Errorf("There are no configured accounts to serve")
+		defer stopMetrics()
+	}
+	if addr, _ := cmd.Flags().GetString("health-addr"); addr != "" {
+		stopHealth, err := cli.startHealthServer(bot, addr)
+		if err != nil {
+			return err
+		}
+		defer stopHealth()
 	}
-}
 
-func qrCallback(cli *BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string) {
-	var err error
-	var accounts []uint32
-	if cli.SelectedAccount == 0 { // for all accounts
-		accounts, err = bot.Rpc.GetAllAccountIds()
-	} else {
-		accounts = []uint32{cli.SelectedAccount}
+	if dir, _ := cmd.Flags().GetString("backup-dir"); dir != "" {
+		interval, _ := cmd.Flags().GetDuration("backup-interval")
+		keep, _ := cmd.Flags().GetInt("backup-keep")
+		passphrase, err := readPassphrase(cmd)
+		if err != nil {
+			return err
+		}
+		stopBackups, err := cli.startBackups(bot, dir, interval, keep, passphrase)
+		if err != nil {
+			return err
+		}
+		defer stopBackups()
+	}
+
+	cli.Logger.Infof("Listening at: %v", strings.Join(inviteLinks, "\n"))
+	if cli.onStart != nil {
+		cli.onStart(cli, bot, cmd, args)
 	}
+	return bot.Run()
+}
+
+func qrCallback(cli *BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string) error {
+	accounts, err := selectedAccounts(cli, bot)
 	if err != nil {
-		cli.Logger.Error(err)
-		return
+		return err
 	}
 
-	for _, accId := range accounts {
-		fmt.Printf("Account #%v:\n", accId)
-		qrForAcc(cli, bot, cmd, args, accId)
-		fmt.Println("")
+	outputs, err := forEachAccount(accounts, func(out *accountOutput) error {
+		return qrForAcc(cli, bot, cmd, args, out)
+	})
+	return errors.Join(printOutputs(cli, cmd, outputs, true), err)
+}
+
+func qrForAcc(cli *BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string, out *accountOutput) error {
+	if out.Configured, _ = bot.Rpc.IsConfigured(out.Id); !out.Configured {
+		return &AccountNotConfiguredErr{AccId: out.Id}
+	}
+	qrdata, err := bot.Rpc.GetChatSecurejoinQrCode(out.Id, nil)
+	if err != nil {
+		return fmt.Errorf("failed to generate invite link: %w", err)
 	}
+	out.InviteLink = qrdata
+	out.text = append(out.text, qrdata)
+	return nil
+}
 
-	if len(accounts) == 0 {
-		cli.Logger.Errorf("There are no accounts yet, add a new account using the init subcommand")
+func adminCallback(cli *BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string) error {
+	accounts, err := selectedAccounts(cli, bot)
+	if err != nil {
+		return err
 	}
+
+	outputs, err := forEachAccount(accounts, func(out *accountOutput) error {
+		return adminForAcc(cli, bot, cmd, args, out)
+	})
+	return errors.Join(printOutputs(cli, cmd, outputs, true), err)
 }
 
-func qrForAcc(cli *BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string, accId uint32) {
-	if isConf, _ := bot.Rpc.IsConfigured(accId); isConf {
-		qrdata, err := bot.Rpc.GetChatSecurejoinQrCode(accId, nil)
-		if err != nil {
-			cli.Logger.Errorf("Failed to generate invite link: %v", err)
-			return
-		}
-		fmt.Println(qrdata)
-	} else {
-		cli.Logger.Error("account not configured")
+func adminForAcc(cli *BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string, out *accountOutput) error {
+	if out.Configured, _ = bot.Rpc.IsConfigured(out.Id); !out.Configured {
+		return &AccountNotConfiguredErr{AccId: out.Id}
+	}
+
+	reset, err := cmd.Flags().GetBool("reset")
+	if err != nil {
+		return err
 	}
+	qrdata, err := roleQrForAcc(cli, bot, out.Id, RoleAdmin, reset)
+	if err != nil {
+		return fmt.Errorf("failed to generate QR: %w", err)
+	}
+
+	out.InviteLink = qrdata
+	out.text = append(out.text, "Use this invite link to become bot administrator", qrdata)
+	return nil
 }
 
-func adminCallback(cli *BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string) {
-	var err error
-	var accounts []uint32
-	if cli.SelectedAccount == 0 { // for all accounts
-		accounts, err = bot.Rpc.GetAllAccountIds()
-		if err == nil && len(accounts) == 0 {
-			cli.Logger.Errorf("There are no accounts yet, add a new account using the init subcommand")
+func rolesCallback(cli *BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string) error {
+	roles := cli.ChatRoles()
+	if len(args) == 1 {
+		if !slices.Contains(roles, args[0]) {
+			return &RoleNotFoundErr{Role: args[0]}
 		}
-	} else {
-		accounts = []uint32{cli.SelectedAccount}
+		roles = args
+	} else if reset, _ := cmd.Flags().GetBool("reset"); reset {
+		return errors.New("a role is needed to use the -r/--reset option")
 	}
+
+	accounts, err := selectedAccounts(cli, bot)
 	if err != nil {
-		cli.Logger.Error(err)
-		return
+		return err
 	}
 
-	for _, accId := range accounts {
-		fmt.Printf("Account #%v:\n", accId)
-		adminForAcc(cli, bot, cmd, args, accId)
-		fmt.Println("")
-	}
+	outputs, err := forEachAccount(accounts, func(out *accountOutput) error {
+		return rolesForAcc(cli, bot, cmd, roles, out)
+	})
+	return errors.Join(printOutputs(cli, cmd, outputs, true), err)
 }
 
-func adminForAcc(cli *BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string, accId uint32) {
-	if isConf, _ := bot.Rpc.IsConfigured(accId); !isConf {
-		cli.Logger.Error("account not configured")
-		return
+func rolesForAcc(cli *BotCli, bot *deltachat.Bot, cmd *cobra.Command, roles []string, out *accountOutput) error {
+	if out.Configured, _ = bot.Rpc.IsConfigured(out.Id); !out.Configured {
+		return &AccountNotConfiguredErr{AccId: out.Id}
 	}
 
-	errMsg := "Failed to generate QR: %v"
-
 	reset, err := cmd.Flags().GetBool("reset")
 	if err != nil {
-		cli.Logger.Errorf(errMsg, err)
-		return
+		return err
 	}
+	out.Roles = make(map[string]string)
+	var errs []error
+	for _, role := range roles {
+		qrdata, err := roleQrForAcc(cli, bot, out.Id, role, reset)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("failed to generate QR for role %q: %w", role, err))
+			continue
+		}
+		out.Roles[role] = qrdata
+		out.text = append(out.text, fmt.Sprintf("%v: %v", role, qrdata))
+	}
+	return errors.Join(errs...)
+}
+
+// Get the invite link to the group of the given role.
+func roleQrForAcc(cli *BotCli, bot *deltachat.Bot, accId uint32, role string, reset bool) (string, error) {
 	var chatId uint32
+	var err error
 	if reset {
-		chatId, err = cli.ResetAdminChat(bot, accId)
+		chatId, err = cli.ResetRoleChat(bot, accId, role)
 	} else {
-		chatId, err = cli.AdminChat(bot, accId)
+		chatId, err = cli.RoleChat(bot, accId, role)
+	}
+	if err != nil {
+		return "", err
 	}
+
+	return bot.Rpc.GetChatSecurejoinQrCode(accId, &chatId)
+}
+
+func listCallback(cli *BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string) error {
+	if cli.SelectedAccount != 0 {
+		return errSingleAccount
+	}
+
+	accounts, err := bot.Rpc.GetAllAccountIds()
 	if err != nil {
-		cli.Logger.Errorf(errMsg, err)
-		return
+		return err
 	}
+	outputs, err := forEachAccount(accounts, func(out *accountOutput) error {
+		return listForAcc(cli, bot, out)
+	})
+	return errors.Join(printOutputs(cli, cmd, outputs, false), err)
+}
 
-	qrdata, err := bot.Rpc.GetChatSecurejoinQrCode(accId, &chatId)
+func listForAcc(cli *BotCli, bot *deltachat.Bot, out *accountOutput) error {
+	out.Configured, _ = bot.Rpc.IsConfigured(out.Id)
+	relays, err := bot.Rpc.ListTransports(out.Id)
 	if err != nil {
-		cli.Logger.Errorf(errMsg, err)
-		return
+		return err
 	}
 
-	fmt.Println("Use this invite link to become bot administrator")
-	fmt.Println(qrdata)
+	out.Addresses = make([]string, 0, len(relays))
+	for _, relay := range relays {
+		out.Addresses = append(out.Addresses, relay.Addr)
+	}
+	addrs := strings.Join(out.Addresses, ", ")
+	if addrs == "" {
+		addrs = "(not configured)"
+	}
+	out.text = append(out.text, fmt.Sprintf("#%v - %v", out.Id, addrs))
+	return nil
 }
 
-func listCallback(cli *BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string) {
-	if cli.SelectedAccount != 0 {
-		cli.Logger.Errorf("operation not supported for a single account, discard the -a/--account option and try again")
-		return
+func removeCallback(cli *BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string) error {
+	accounts, err := accountsToRemove(cli, bot, args)
+	if err != nil {
+		return err
+	}
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	yes, _ := cmd.Flags().GetBool("yes")
+	backupDir, _ := cmd.Flags().GetString("backup-dir")
+	passphrase, err := readPassphrase(cmd)
+	if err != nil {
+		return err
 	}
 
-	accounts, err := bot.Rpc.GetAllAccountIds()
+	outputs, err := forEachAccount(accounts, func(out *accountOutput) error {
+		return listForAcc(cli, bot, out)
+	})
 	if err != nil {
-		cli.Logger.Error(err)
-		return
+		return err
+	}
+	var notBackedUp []string
+	if backupDir != "" {
+		for _, out := range outputs {
+			if !out.Configured {
+				out.text[0] += " (not configured, no backup)"
+				notBackedUp = append(notBackedUp, fmt.Sprintf("#%v", out.Id))
+			}
+		}
 	}
-	for _, accId := range accounts {
-		relays, err := bot.Rpc.ListTransports(accId)
-		if err != nil {
-			cli.Logger.Error(err)
-			continue
+	if dryRun {
+		for _, out := range outputs {
+			out.text[0] = "Would remove " + out.text[0]
+		}
+		return printOutputs(cli, cmd, outputs, false)
+	}
+	if len(notBackedUp) != 0 && !yes {
+		return fmt.Errorf("can't backup the accounts that are not configured: %v, use --yes to remove them without a backup", strings.Join(notBackedUp, ", "))
+	}
+	if !yes {
+		if err := confirmRemove(cmd, outputs); err != nil {
+			return err
+		}
+	}
+	if backupDir != "" {
+		if err := os.MkdirAll(backupDir, 0750); err != nil {
+			return err
 		}
+	}
 
-		var addrs string
-		for index, relay := range relays {
-			if index == 0 {
-				addrs = relay.Addr
-			} else {
-				addrs += ", " + relay.Addr
+	outputs, err = forEachAccount(accounts, func(out *accountOutput) error {
+		if err := listForAcc(cli, bot, out); err != nil {
+			return err
+		}
+		if backupDir != "" && out.Configured {
+			path, err := cli.exportBackup(bot, out.Id, backupDir, passphrase)
+			if err != nil {
+				return fmt.Errorf("backup failed, account not removed: %w", err)
 			}
+			out.Backup = path
+		} else if backupDir != "" {
+			cli.GetLogger(out.Id).Warn("Account not configured, removing it without a backup")
 		}
-		if addrs == "" {
-			addrs = "(not configured)"
+		if err := bot.Rpc.RemoveAccount(out.Id); err != nil {
+			return err
 		}
-		fmt.Printf("#%v - %v\n", accId, addrs)
-	}
+		out.Removed = true
+		out.text[0] = "Removed " + out.text[0]
+		if out.Backup != "" {
+			out.text = append(out.text, "Backup saved to "+out.Backup)
+		}
+		cli.Logger.Infof("Account #%v removed successfully.", out.Id)
+		return nil
+	})
+	return errors.Join(printOutputs(cli, cmd, outputs, false), err)
 }
 
-func removeCallback(cli *BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string) {
-	var err error
+// Get the accounts given as arguments or with the -a/--account option, if none was given and
+// the bot has a single account, that account is returned.
+func accountsToRemove(cli *BotCli, bot *deltachat.Bot, args []string) ([]uint32, error) {
 	var accounts []uint32
-	if cli.SelectedAccount == 0 { // for all accounts
-		accounts, err = bot.Rpc.GetAllAccountIds()
-		if err == nil && len(accounts) == 0 {
-			cli.Logger.Errorf("There are no accounts yet, add a new account using the init subcommand")
+	if cli.SelectedAccount != 0 {
+		accounts = append(accounts, cli.SelectedAccount)
+	}
+	for _, arg := range args {
+		accId, err := cli.ResolveAccount(bot, arg)
+		if err != nil {
+			return nil, err
+		}
+		if !slices.Contains(accounts, accId) {
+			accounts = append(accounts, accId)
 		}
-	} else {
-		accounts = []uint32{cli.SelectedAccount}
 	}
-	if err != nil {
-		cli.Logger.Error(err)
-		return
+	if len(accounts) != 0 {
+		return accounts, nil
 	}
 
-	if len(accounts) > 1 {
-		cli.Logger.Error("There are more than one account, to remove one of them, pass the account address with -a/--account option")
-		return
+	accounts, err := selectedAccounts(cli, bot)
+	if err != nil || len(accounts) == 1 {
+		return accounts, err
+	}
+	outputs, _ := forEachAccount(accounts, func(out *accountOutput) error {
+		return listForAcc(cli, bot, out)
+	})
+	var lines []string
+	for _, out := range outputs {
+		lines = append(lines, out.text...)
 	}
+	return nil, fmt.Errorf("there are more than one account, pass the IDs or addresses of the accounts to remove as arguments. Existing accounts:\n%v", strings.Join(lines, "\n"))
+}
 
-	for _, accId := range accounts {
-		err = bot.Rpc.RemoveAccount(accId)
-		if err != nil {
-			cli.Logger.Error(err)
-		} else {
-			cli.Logger.Infof("Account #%v removed successfully.", accId)
-		}
+// Ask the user to confirm the removal of the given accounts, the question is written to the error output
+// so it doesn't mix with the command's output. Returns an error if the removal was not confirmed.
+func confirmRemove(cmd *cobra.Command, outputs []*accountOutput) error {
+	writer := cmd.ErrOrStderr()
+	fmt.Fprintln(writer, "The following accounts will be removed, this can't be undone:")
+	for _, out := range outputs {
+		fmt.Fprintln(writer, out.text[0])
+	}
+	fmt.Fprint(writer, "Continue? [y/N] ")
+	answer, _ := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+	if answer != "y" && answer != "yes" {
+		return errors.New("removal canceled")
+	}
+	return nil
+}
+
+// Get the account selected with the -a/--account option or all accounts if no account was selected.
+func selectedAccounts(cli *BotCli, bot *deltachat.Bot) ([]uint32, error) {
+	if cli.SelectedAccount != 0 {
+		return []uint32{cli.SelectedAccount}, nil
+	}
+	accounts, err := bot.Rpc.GetAllAccountIds()
+	if err == nil && len(accounts) == 0 {
+		err = &NoAccountsErr{}
 	}
+	return accounts, err
 }
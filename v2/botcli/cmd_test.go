@@ -0,0 +1,163 @@
+package botcli_test
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chatmail/rpc-client-go/v2/deltachat"
+	"github.com/deltachat-bot/deltabot-cli-go/v2/botcli"
+	"github.com/deltachat-bot/deltabot-cli-go/v2/botcli/botclitest"
+	"github.com/deltachat-bot/deltabot-cli-go/v2/botcli/bottest"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestServe_RecoverEventHandlerPanics(t *testing.T) {
+	t.Parallel()
+	fake := bottest.New()
+	accId := fake.AddAccount("bot@example.org")
+	cli := newFakeCli(fake)
+	cli.NotifyPanics = true
+	cli.On(&deltachat.EventTypeIncomingMsg{}, func(bot *deltachat.Bot, accId uint32, event deltachat.EventType) {
+		msg, err := bot.Rpc.GetMessage(accId, event.(*deltachat.EventTypeIncomingMsg).MsgId)
+		require.Nil(t, err)
+		if msg.Text == "panic" {
+			panic("boom")
+		}
+	})
+	cli.OnUnhandledEvent(func(bot *deltachat.Bot, accId uint32, event deltachat.EventType) {
+		if _, ok := event.(*deltachat.EventTypeSelfavatarChanged); ok {
+			panic("unhandled boom")
+		}
+	})
+	cli.OnNewMsg(func(cli *botcli.BotCli, bot *deltachat.Bot, accId uint32, msg *deltachat.Message, logger *zap.SugaredLogger) {
+		_, err := bot.Rpc.MiscSendTextMessage(accId, msg.ChatId, msg.Text)
+		require.Nil(t, err)
+	})
+	serveFake(t, cli, fake)
+
+	adminChatId, err := cli.AdminChat(deltachat.NewBot(fake.Rpc()), accId)
+	require.Nil(t, err)
+	fake.ReceiveText(accId, "alice@example.org", "panic")
+	fake.Emit(accId, &deltachat.EventTypeSelfavatarChanged{})
+	fake.ReceiveText(accId, "alice@example.org", "hello")
+
+	var texts []string
+	for range 4 {
+		msg, err := fake.NextSentMsg(accId, time.Second)
+		require.Nil(t, err)
+		if msg.ChatId == adminChatId {
+			texts = append(texts, "admin: "+msg.Text)
+		} else {
+			texts = append(texts, msg.Text)
+		}
+	}
+	require.Equal(t, []string{
+		"admin: Recovered from panic in handler event IncomingMsg: boom",
+		"panic",
+		"admin: Recovered from panic in handler event SelfavatarChanged: unhandled boom",
+		"hello",
+	}, texts)
+
+	_, err = fake.NextSentMsg(accId, 10*time.Millisecond)
+	require.NotNil(t, err)
+}
+
+func TestAccountFlag(t *testing.T) {
+	t.Parallel()
+	fake := bottest.New()
+	fake.AddAccount("bot1@example.org")
+	accId := fake.AddAccount("bot2@example.org")
+	bot := deltachat.NewBot(fake.Rpc())
+	cli := botcli.New("testbot")
+
+	resolved, err := cli.ResolveAccount(bot, "Bot2@Example.org")
+	require.Nil(t, err)
+	require.Equal(t, accId, resolved)
+	resolved, err = cli.ResolveAccount(bot, fmt.Sprint(accId))
+	require.Nil(t, err)
+	require.Equal(t, accId, resolved)
+
+	for _, selector := range []string{"unknown@example.org", "10"} {
+		_, err = cli.ResolveAccount(bot, selector)
+		var notFoundErr *botcli.AccountNotFoundErr
+		require.ErrorAs(t, err, &notFoundErr)
+	}
+
+	result := runFake(t, fake, "-a=bot2@example.org", "config", "addr")
+	require.Nil(t, result.Err)
+	require.Contains(t, result.Stdout, "Account #2:\naddr=bot2@example.org\n")
+	result = runFake(t, fake, "-a=unknown@example.org", "config", "addr")
+	require.ErrorAs(t, result.Err, new(*botcli.AccountNotFoundErr))
+
+	// the account is resolved with the Rpc set in OnBotInit()
+	other := bottest.New()
+	other.AddAccount("other@example.org")
+	cli = newFakeCli(fake)
+	cli.OnBotInit(func(cli *botcli.BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string) {
+		bot.Rpc = other.Rpc()
+	})
+	result = botclitest.RunCli(t, cli, "-a=other@example.org", "config", "addr")
+	require.Nil(t, result.Err)
+	require.Contains(t, result.Stdout, "Account #1:\naddr=other@example.org\n")
+}
+
+func TestRemove(t *testing.T) {
+	t.Parallel()
+	fake := bottest.New()
+	fake.AddAccount("bot1@example.org")
+	fake.AddAccount("bot2@example.org")
+	fake.AddAccount("bot3@example.org")
+	accounts := func() []uint32 {
+		ids, err := fake.Rpc().GetAllAccountIds()
+		require.Nil(t, err)
+		return ids
+	}
+
+	result := runFake(t, fake, "remove")
+	require.NotNil(t, result.Err)
+	require.Contains(t, result.Err.Error(), "#2 - bot2@example.org")
+
+	result = runFake(t, fake, "remove", "--dry-run", "1", "bot2@example.org")
+	require.Nil(t, result.Err)
+	require.Equal(t, "Would remove #1 - bot1@example.org\nWould remove #2 - bot2@example.org\n", result.Stdout)
+	require.Equal(t, []uint32{1, 2, 3}, accounts())
+
+	cli := newFakeCli(fake)
+	cli.RootCmd.SetIn(strings.NewReader("n\n"))
+	result = botclitest.RunCli(t, cli, "remove", "1")
+	require.NotNil(t, result.Err)
+	require.Contains(t, result.Stderr, "Continue? [y/N]")
+	require.Equal(t, []uint32{1, 2, 3}, accounts())
+
+	backupDir := t.TempDir()
+	cli = newFakeCli(fake)
+	cli.RootCmd.SetIn(strings.NewReader("y\n"))
+	result = botclitest.RunCli(t, cli, "remove", "--backup-dir="+backupDir, "1", "bot2@example.org")
+	require.Nil(t, result.Err)
+	require.Equal(t, []uint32{3}, accounts())
+	files, err := filepath.Glob(filepath.Join(backupDir, "testbot-account*.tar"))
+	require.Nil(t, err)
+	require.Len(t, files, 2)
+
+	unconfigured := fake.AddAccount("")
+	result = runFake(t, fake, "remove", "--dry-run", "--backup-dir="+backupDir, fmt.Sprint(unconfigured))
+	require.Nil(t, result.Err)
+	require.Contains(t, result.Stdout, "(not configured, no backup)")
+	result = runFake(t, fake, "remove", "--backup-dir="+backupDir, fmt.Sprint(unconfigured))
+	require.ErrorContains(t, result.Err, "use --yes")
+	require.Equal(t, []uint32{3, unconfigured}, accounts())
+	result = runFake(t, fake, "--log-level=warn", "remove", "--yes", "--backup-dir="+backupDir, fmt.Sprint(unconfigured))
+	require.Nil(t, result.Err)
+	require.Contains(t, result.Log, "removing it without a backup")
+	require.Equal(t, []uint32{3}, accounts())
+
+	result = runFake(t, fake, "remove", "--yes")
+	require.Nil(t, result.Err)
+	require.Equal(t, "Removed #3 - bot3@example.org\n", result.Stdout)
+	require.Empty(t, accounts())
+}
@@ -0,0 +1,125 @@
+package botcli
+
+import (
+	"errors"
+	"fmt"
+	"maps"
+	"os"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"github.com/spf13/pflag"
+	"gopkg.in/yaml.v3"
+)
+
+// Name of the optional configuration file inside the program's data folder.
+const configFileName = "config.yaml"
+
+// Options skipping confirmations or resetting data, they can only be given in the command line.
+var commandLineOnlyFlags = []string{"yes", "reset"}
+
+// Set the value of the flags not given in command line from environment variables and the configuration file.
+//
+// The value of a flag is taken from, in order of precedence:
+//   - the command line, ex. --log-level=info
+//   - an environment variable with the program name as prefix, ex. MYBOT_LOG_LEVEL=info
+//   - the config.yaml file in the program's data folder, ex. "log-level: info"
+//   - the flag's default value
+func loadFlags(cli *BotCli, flags *pflag.FlagSet) error {
+	if err := loadFlagsFromEnv(cli, flags); err != nil {
+		return err
+	}
+
+	path := filepath.Join(cli.AppDir, configFileName)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	} else if err != nil {
+		return err
+	}
+	var config map[string]any
+	if err := yaml.Unmarshal(data, &config); err != nil {
+		return fmt.Errorf("invalid configuration file %v: %w", path, err)
+	}
+	for _, name := range append([]string{"folder"}, commandLineOnlyFlags...) {
+		if _, ok := config[name]; ok {
+			return fmt.Errorf("invalid configuration file %v: the %v option can not be set in the configuration file", path, name)
+		}
+	}
+	if err := checkConfigKeys(cli.RootCmd, config, path); err != nil {
+		return err
+	}
+	return loadFlagsFromMap(flags, config, path)
+}
+
+// Check that the keys of the given settings are options of the program or any of its subcommands, to catch typos.
+// Options of other subcommands are allowed since the same configuration file is used by all subcommands.
+func checkConfigKeys(root *cobra.Command, config map[string]any, source string) error {
+	known := make(map[string]bool)
+	var visit func(cmd *cobra.Command)
+	visit = func(cmd *cobra.Command) {
+		addFlag := func(flag *pflag.Flag) { known[flag.Name] = true }
+		cmd.PersistentFlags().VisitAll(addFlag)
+		cmd.Flags().VisitAll(addFlag)
+		for _, subcmd := range cmd.Commands() {
+			visit(subcmd)
+		}
+	}
+	visit(root)
+
+	var errs []error
+	for _, name := range slices.Sorted(maps.Keys(config)) {
+		if !known[name] {
+			errs = append(errs, fmt.Errorf("unknown option %q in %v", name, source))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Set the value of the flags not given in command line from environment variables, ex. the --log-level flag
+// of the "mybot" program can be set with MYBOT_LOG_LEVEL.
+func loadFlagsFromEnv(cli *BotCli, flags *pflag.FlagSet) error {
+	prefix := getEnvPrefix(cli.AppName)
+	var errs []error
+	flags.VisitAll(func(flag *pflag.Flag) {
+		if flag.Changed || flag.Name == "help" {
+			return
+		}
+		key := prefix + strings.ToUpper(strings.ReplaceAll(flag.Name, "-", "_"))
+		if value, ok := os.LookupEnv(key); ok {
+			if slices.Contains(commandLineOnlyFlags, flag.Name) {
+				errs = append(errs, fmt.Errorf("invalid environment variable %v: the %v option can only be given in the command line", key, flag.Name))
+			} else if err := flags.Set(flag.Name, value); err != nil {
+				errs = append(errs, fmt.Errorf("invalid value in environment variable %v: %w", key, err))
+			}
+		}
+	})
+	return errors.Join(errs...)
+}
+
+// Set the value of the flags not given in command line or environment variables from the given settings.
+func loadFlagsFromMap(flags *pflag.FlagSet, config map[string]any, source string) error {
+	var errs []error
+	for name, value := range config {
+		flag := flags.Lookup(name)
+		if flag == nil || flag.Changed {
+			continue
+		}
+		var strval string
+		if list, ok := value.([]any); ok {
+			items := make([]string, 0, len(list))
+			for _, item := range list {
+				items = append(items, fmt.Sprint(item))
+			}
+			strval = strings.Join(items, ",")
+		} else {
+			strval = fmt.Sprint(value)
+		}
+		if err := flags.Set(name, strval); err != nil {
+			errs = append(errs, fmt.Errorf("invalid value for %q in %v: %w", name, source, err))
+		}
+	}
+	return errors.Join(errs...)
+}
@@ -0,0 +1,86 @@
+package botcli
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+// not parallel, environment variables are modified
+func TestLoadFlags(t *testing.T) {
+	dir := acfactory.MkdirTemp()
+	config := "log-level: error\nlog-format: json\nlog-max-size: 10\nmetrics-addr: 127.0.0.1:9090\n"
+	require.Nil(t, os.WriteFile(filepath.Join(dir, configFileName), []byte(config), 0600))
+	t.Setenv("TEST_BOT_FOLDER", dir)
+	t.Setenv("TEST_BOT_LOG_LEVEL", "warn")
+	t.Setenv("TEST_BOT_LOG_FORMAT", "json")
+
+	cli := New("test-bot")
+	require.Nil(t, cli.RootCmd.ParseFlags([]string{"--log-format=console"}))
+	require.Nil(t, loadFlags(cli, cli.RootCmd.Flags()))
+	require.Equal(t, dir, cli.AppDir)
+	require.Equal(t, "warn", cli.logOpts.level)
+	require.Equal(t, "console", cli.logOpts.format)
+	require.Equal(t, 10, cli.logOpts.maxSize)
+	require.Equal(t, 5, cli.logOpts.maxBackups)
+
+	t.Setenv("TEST_BOT_LOG_MAX_BACKUPS", "many")
+	cli = New("test-bot")
+	require.Nil(t, cli.RootCmd.ParseFlags(nil))
+	require.NotNil(t, loadFlags(cli, cli.RootCmd.Flags()))
+}
+
+func TestLoadFlags_InvalidConfig(t *testing.T) {
+	t.Parallel()
+	tests := []struct {
+		config string
+		err    string
+	}{
+		{"folder: /tmp/other\n", "the folder option can not be set"},
+		{"log-levl: info\n", `unknown option "log-levl"`},
+		{"yes: true\n", "the yes option can not be set"},
+		{"reset: true\n", "the reset option can not be set"},
+	}
+	for _, test := range tests {
+		dir := t.TempDir()
+		require.Nil(t, os.WriteFile(filepath.Join(dir, configFileName), []byte(test.config), 0600))
+		cli := New("invalid-config-bot")
+		require.Nil(t, cli.RootCmd.ParseFlags([]string{"--folder=" + dir}))
+		err := loadFlags(cli, cli.RootCmd.Flags())
+		require.ErrorContains(t, err, test.err)
+		require.Equal(t, dir, cli.AppDir)
+	}
+}
+
+// not parallel, environment variables are modified
+func TestLoadFlags_CommandLineOnly(t *testing.T) {
+	t.Setenv("TEST_BOT_FOLDER", t.TempDir())
+	tests := []struct {
+		cmd  string
+		flag string
+	}{
+		{"remove", "yes"},
+		{"admin", "reset"},
+		{"roles", "reset"},
+	}
+	for _, test := range tests {
+		key := "TEST_BOT_" + strings.ToUpper(test.flag)
+		t.Setenv(key, "true")
+		cli := New("test-bot")
+		cmd, _, err := cli.RootCmd.Find([]string{test.cmd})
+		require.Nil(t, err)
+		require.Nil(t, cmd.ParseFlags(nil))
+		err = loadFlags(cli, cmd.Flags())
+		require.ErrorContains(t, err, "invalid environment variable "+key)
+		value, err := cmd.Flags().GetBool(test.flag)
+		require.Nil(t, err)
+		require.False(t, value)
+
+		require.Nil(t, cmd.ParseFlags([]string{"--" + test.flag}))
+		require.Nil(t, loadFlags(cli, cmd.Flags()))
+		os.Unsetenv(key)
+	}
+}
@@ -1,5 +1,13 @@
 package botcli
 
+import (
+	"errors"
+	"fmt"
+	"os"
+)
+
+var errSingleAccount = errors.New("operation not supported for a single account, discard the -a/--account option and try again")
+
 // The bot is not configured yet.
 type BotNotConfiguredErr struct{}
 
@@ -7,9 +15,69 @@ func (error *BotNotConfiguredErr) Error() string {
 	return "bot account not configured"
 }
 
+// The selected account is not configured yet.
+type AccountNotConfiguredErr struct{ AccId uint32 }
+
+func (error *AccountNotConfiguredErr) Error() string {
+	return fmt.Sprintf("account #%v not configured", error.AccId)
+}
+
+// There are no accounts yet.
+type NoAccountsErr struct{}
+
+func (error *NoAccountsErr) Error() string {
+	return "there are no accounts yet, add a new account using the init subcommand"
+}
+
 // The account was not found.
 type AccountNotFoundErr struct{ Addr string }
 
 func (error *AccountNotFoundErr) Error() string {
 	return "account not found: " + error.Addr
 }
+
+// The subcommand was interrupted by a SIGINT or SIGTERM signal.
+type InterruptedErr struct{ Signal os.Signal }
+
+func (error *InterruptedErr) Error() string {
+	return fmt.Sprintf("interrupted by %v signal", error.Signal)
+}
+
+// The role was not registered.
+type RoleNotFoundErr struct{ Role string }
+
+func (error *RoleNotFoundErr) Error() string {
+	return "role not found: " + error.Role
+}
+
+// The deltachat-rpc-server program could not be started.
+type RpcServerStartErr struct{ Err error }
+
+func (error *RpcServerStartErr) Error() string {
+	return fmt.Sprintf("failed to start RPC server, read https://github.com/chatmail/core/tree/main/deltachat-rpc-server for installation instructions. Error message: %v", error.Err)
+}
+
+func (error *RpcServerStartErr) Unwrap() error {
+	return error.Err
+}
+
+// The deltachat-rpc-server program was not found.
+type RpcServerNotFoundErr struct{ Err error }
+
+func (error *RpcServerNotFoundErr) Error() string {
+	return fmt.Sprintf("deltachat-rpc-server not found, read https://github.com/chatmail/core/tree/main/deltachat-rpc-server for installation instructions. Error message: %v", error.Err)
+}
+
+func (error *RpcServerNotFoundErr) Unwrap() error {
+	return error.Err
+}
+
+// The version of deltachat-rpc-server is not the version this package was built against.
+type RpcServerVersionMismatchErr struct {
+	Expected string
+	Actual   string
+}
+
+func (error *RpcServerVersionMismatchErr) Error() string {
+	return fmt.Sprintf("deltachat-rpc-server version %v does not match the expected version %v, install the matching version or use --allow-version-mismatch", error.Actual, error.Expected)
+}
@@ -0,0 +1,42 @@
+package botcli_test
+
+import (
+	"testing"
+
+	"github.com/chatmail/rpc-client-go/v2/deltachat"
+	"github.com/deltachat-bot/deltabot-cli-go/v2/botcli"
+	"github.com/deltachat-bot/deltabot-cli-go/v2/botcli/botclitest"
+	"github.com/deltachat-bot/deltabot-cli-go/v2/botcli/bottest"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+// Create a new bot that uses the given fake.
+func newFakeCli(fake *bottest.Transport) *botcli.BotCli {
+	cli := botcli.New("testbot")
+	cli.TransportFactory = fake.Factory
+	return cli
+}
+
+// Run a new bot that uses the given fake with the given command line arguments and a new empty data folder.
+func runFake(t *testing.T, fake *bottest.Transport, args ...string) *botclitest.Result {
+	return botclitest.RunCli(t, newFakeCli(fake), args...)
+}
+
+// Run the serve subcommand of the given bot with the given options using the given fake until the test ends.
+func serveFake(t *testing.T, cli *botcli.BotCli, fake *bottest.Transport, args ...string) *deltachat.Bot {
+	botChan := make(chan *deltachat.Bot, 1)
+	cli.OnBotStart(func(cli *botcli.BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string) {
+		botChan <- bot
+	})
+	cli.TransportFactory = fake.Factory
+	cli.RootCmd.SetArgs(append([]string{"-f=" + t.TempDir(), "--log-level=error", "serve"}, args...))
+	done := make(chan error, 1)
+	go func() { done <- cli.Start() }()
+	bot := <-botChan
+	t.Cleanup(func() {
+		bot.Stop()
+		require.Nil(t, <-done)
+	})
+	return bot
+}
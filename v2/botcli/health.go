@@ -0,0 +1,88 @@
+package botcli
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"github.com/chatmail/rpc-client-go/v2/deltachat"
+)
+
+// Minimum connectivity value of a connected account, see Rpc.GetConnectivity().
+const connectivityConnected = 4000
+
+// Health status of a single account, reported by the /healthz and /readyz endpoints.
+type accountHealth struct {
+	Id           uint32 `json:"id"`
+	Configured   bool   `json:"configured"`
+	Connected    bool   `json:"connected"`
+	Connectivity uint32 `json:"connectivity"`
+	Error        string `json:"error,omitempty"`
+}
+
+// Response of the /healthz and /readyz endpoints.
+type healthStatus struct {
+	Ok            bool             `json:"ok"`
+	Running       bool             `json:"running"`
+	TransportOpen bool             `json:"transportOpen"`
+	Accounts      []*accountHealth `json:"accounts"`
+	Error         string           `json:"error,omitempty"`
+}
+
+// Get the health status of the bot and its accounts.
+func getHealthStatus(bot *deltachat.Bot) *healthStatus {
+	status := &healthStatus{Running: bot.IsRunning(), Accounts: []*accountHealth{}}
+	if _, err := bot.Rpc.GetSystemInfo(); err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	status.TransportOpen = true
+
+	accounts, err := bot.Rpc.GetAllAccountIds()
+	if err != nil {
+		status.Error = err.Error()
+		return status
+	}
+	for _, accId := range accounts {
+		acc := &accountHealth{Id: accId}
+		acc.Configured, err = bot.Rpc.IsConfigured(accId)
+		if err == nil && acc.Configured {
+			acc.Connectivity, err = bot.Rpc.GetConnectivity(accId)
+			acc.Connected = acc.Connectivity >= connectivityConnected
+		}
+		if err != nil {
+			acc.Error = err.Error()
+		}
+		status.Accounts = append(status.Accounts, acc)
+	}
+	return status
+}
+
+// Start serving the /healthz and /readyz endpoints over HTTP at the given address until the returned function is called.
+//
+// /healthz succeeds if the RPC server is reachable and the bot is running,
+// /readyz succeeds if additionally all accounts are configured and connected.
+func (botcli *BotCli) startHealthServer(bot *deltachat.Bot, addr string) (func(), error) {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/healthz", func(writer http.ResponseWriter, request *http.Request) {
+		status := getHealthStatus(bot)
+		status.Ok = status.TransportOpen && status.Running
+		writeHealthStatus(writer, status)
+	})
+	mux.HandleFunc("/readyz", func(writer http.ResponseWriter, request *http.Request) {
+		status := getHealthStatus(bot)
+		status.Ok = status.TransportOpen && status.Running && len(status.Accounts) != 0
+		for _, acc := range status.Accounts {
+			status.Ok = status.Ok && acc.Configured && acc.Connected
+		}
+		writeHealthStatus(writer, status)
+	})
+	return botcli.serveHttp(addr, mux)
+}
+
+func writeHealthStatus(writer http.ResponseWriter, status *healthStatus) {
+	writer.Header().Set("Content-Type", "application/json")
+	if !status.Ok {
+		writer.WriteHeader(http.StatusServiceUnavailable)
+	}
+	_ = json.NewEncoder(writer).Encode(status)
+}
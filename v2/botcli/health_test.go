@@ -0,0 +1,53 @@
+package botcli
+
+import (
+	"encoding/json"
+	"io"
+	"net"
+	"net/http"
+	"testing"
+
+	"github.com/chatmail/rpc-client-go/v2/deltachat"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+)
+
+func freeAddr(t *testing.T) string {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.Nil(t, err)
+	defer listener.Close()
+	return listener.Addr().String()
+}
+
+func TestServeHttpEndpoints(t *testing.T) {
+	t.Parallel()
+	cli := New("testbot")
+	var cliBot *deltachat.Bot
+	cli.OnBotInit(func(cli *BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string) {
+		cliBot = bot
+	})
+	healthAddr, metricsAddr := freeAddr(t), freeAddr(t)
+	go RunConfiguredCli(cli, "serve", "--health-addr", healthAddr, "--metrics-addr", metricsAddr) //nolint:errcheck
+	for cliBot == nil || !cliBot.IsRunning() {
+	}
+	defer cliBot.Stop()
+
+	resp, err := http.Get("http://" + healthAddr + "/healthz")
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	require.Equal(t, http.StatusOK, resp.StatusCode)
+	var status healthStatus
+	require.Nil(t, json.NewDecoder(resp.Body).Decode(&status))
+	require.True(t, status.Ok)
+	require.True(t, status.TransportOpen)
+	require.Len(t, status.Accounts, 1)
+	require.True(t, status.Accounts[0].Configured)
+
+	resp, err = http.Get("http://" + metricsAddr + "/metrics")
+	require.Nil(t, err)
+	defer resp.Body.Close()
+	body, err := io.ReadAll(resp.Body)
+	require.Nil(t, err)
+	require.Contains(t, string(body), "deltabot_account_configured{account=\"1\"} 1")
+	require.Contains(t, string(body), "deltabot_core_info{version=")
+}
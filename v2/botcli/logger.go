@@ -1,10 +1,28 @@
 package botcli
 
 import (
+	"fmt"
+	"os"
+
+	"github.com/chatmail/rpc-client-go/v2/deltachat"
+	"github.com/spf13/cobra"
 	"go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
+	"gopkg.in/natefinch/lumberjack.v2"
 )
 
+// Name of the built-in chat command to change the log level at runtime, see onLogLevelCmd().
+const logLevelCmd = "loglevel"
+
+// Logging options, set by the --log-* flags in command line.
+type logOptions struct {
+	level      string
+	format     string
+	file       string
+	maxSize    int
+	maxBackups int
+}
+
 func getEncoderConfig() zapcore.EncoderConfig {
 	return zapcore.EncoderConfig{
 		TimeKey:          "T",
@@ -23,15 +41,113 @@ func getEncoderConfig() zapcore.EncoderConfig {
 	}
 }
 
-func getLogger() *zap.SugaredLogger {
-	config := zap.Config{
-		Level:            zap.NewAtomicLevelAt(zap.DebugLevel),
-		Development:      false,
-		Encoding:         "console",
-		EncoderConfig:    getEncoderConfig(),
-		OutputPaths:      []string{"stderr"},
-		ErrorOutputPaths: []string{"stderr"},
+func getLogger(level zap.AtomicLevel) *zap.SugaredLogger {
+	return newLogger(level, "console", zapcore.Lock(os.Stderr))
+}
+
+func newLogger(level zap.AtomicLevel, format string, output zapcore.WriteSyncer) *zap.SugaredLogger {
+	var encoder zapcore.Encoder
+	if format == "json" {
+		encoder = zapcore.NewJSONEncoder(getEncoderConfig())
+	} else {
+		encoder = zapcore.NewConsoleEncoder(getEncoderConfig())
+	}
+	core := zapcore.NewCore(encoder, output, level)
+	return zap.New(core, zap.ErrorOutput(zapcore.Lock(os.Stderr)), zap.AddStacktrace(zapcore.ErrorLevel)).Sugar()
+}
+
+// zapcore.WriteSyncer writing to the error output of the given command, resolved on every write
+// so the output can be changed with SetErr() after the logger is created.
+type cmdErrWriter struct{ cmd *cobra.Command }
+
+func (writer cmdErrWriter) Write(data []byte) (int, error) {
+	return writer.cmd.ErrOrStderr().Write(data)
+}
+
+func (writer cmdErrWriter) Sync() error {
+	return nil
+}
+
+// Apply the logging options given in the command line.
+func (botcli *BotCli) setupLogger() error {
+	opts := botcli.logOpts
+	level, err := zapcore.ParseLevel(opts.level)
+	if err != nil {
+		return err
+	}
+	botcli.logLevel.SetLevel(level)
+
+	if opts.format != "console" && opts.format != "json" {
+		return fmt.Errorf("invalid log format %q, expected \"console\" or \"json\"", opts.format)
+	}
+	if opts.format != "console" || opts.file != "" || botcli.LogToErrOrStderr { // else keep the default logger
+		output := zapcore.Lock(os.Stderr)
+		if botcli.LogToErrOrStderr {
+			output = zapcore.Lock(cmdErrWriter{botcli.RootCmd})
+		}
+		if opts.file != "" {
+			botcli.logFile = &lumberjack.Logger{
+				Filename:   opts.file,
+				MaxSize:    opts.maxSize,
+				MaxBackups: opts.maxBackups,
+			}
+			output = zapcore.AddSync(botcli.logFile)
+		}
+		botcli.Logger = newLogger(botcli.logLevel, opts.format, output)
+	}
+
+	// count the logged errors for the metrics, including the errors of the loggers derived later
+	botcli.Logger = botcli.Logger.WithOptions(zap.WrapCore(func(core zapcore.Core) zapcore.Core {
+		return &errorCountingCore{Core: core, metrics: botcli.metrics}
+	}))
+	return nil
+}
+
+// Set the log level from the "log-level" setting saved with the /loglevel command.
+func (botcli *BotCli) loadLogLevel(bot *deltachat.Bot) {
+	accounts, err := bot.Rpc.GetAllAccountIds()
+	if err != nil {
+		botcli.Logger.Error(err)
+		return
+	}
+	for _, accId := range accounts {
+		value, err := botcli.GetConfig(bot, accId, "log-level")
+		if err != nil || value == nil {
+			continue
+		}
+		level, err := zapcore.ParseLevel(*value)
+		if err != nil {
+			botcli.GetLogger(accId).Warnf("Invalid saved log level %q: %v", *value, err)
+			continue
+		}
+		botcli.logLevel.SetLevel(level)
+		return
+	}
+}
+
+// Process the /loglevel command, registered as a built-in chat command for bot administrators,
+// it only works in the bot administrators group.
+func onLogLevelCmd(cli *BotCli, bot *deltachat.Bot, req *ChatRequest) {
+	var reply string
+	if chatId, err := cli.AdminChat(bot, req.AccId); err != nil || chatId != req.Msg.ChatId {
+		reply = "The /" + logLevelCmd + " command can only be used in the bot administrators group"
+	} else if len(req.Args) == 0 {
+		reply = "Current log level: " + cli.logLevel.String()
+	} else if level, err := zapcore.ParseLevel(req.Args[0]); err != nil {
+		reply = "Invalid log level, expected one of: debug, info, warn, error"
+	} else {
+		cli.logLevel.SetLevel(level)
+		reply = "Log level set to " + level.String()
+		value := level.String()
+		accounts, _ := bot.Rpc.GetAllAccountIds()
+		for _, accId := range accounts {
+			if err := cli.SetConfig(bot, accId, "log-level", &value); err != nil {
+				cli.GetLogger(accId).Errorf("Failed to save log level: %v", err)
+			}
+		}
+		req.Logger.Infof("Log level set to %v", level)
+	}
+	if err := req.Reply(bot, reply); err != nil {
+		req.Logger.Error(err)
 	}
-	logger, _ := config.Build()
-	return logger.Sugar()
 }
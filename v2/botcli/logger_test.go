@@ -0,0 +1,114 @@
+package botcli
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/chatmail/rpc-client-go/v2/deltachat"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestBotCli_setupLogger(t *testing.T) {
+	t.Parallel()
+	cli := New("testbot")
+	logFile := filepath.Join(acfactory.MkdirTemp(), "bot.log")
+	require.Nil(t, cli.RootCmd.ParseFlags([]string{"--log-level=info", "--log-format=json", "--log-file=" + logFile}))
+	require.Nil(t, cli.setupLogger())
+	require.Equal(t, zap.InfoLevel, cli.logLevel.Level())
+
+	cli.Logger.Debug("hidden message")
+	cli.Logger.Info("visible message")
+	require.Nil(t, cli.Logger.Sync())
+	data, err := os.ReadFile(logFile)
+	require.Nil(t, err)
+	require.NotContains(t, string(data), "hidden message")
+	require.Contains(t, string(data), `"M":"visible message"`)
+
+	cli.logOpts.format = "xml"
+	require.NotNil(t, cli.setupLogger())
+	cli.logOpts.level = "verbose"
+	require.NotNil(t, cli.setupLogger())
+}
+
+func TestBotCli_LogToErrOrStderr(t *testing.T) {
+	t.Parallel()
+	cli := New("testbot")
+	cli.LogToErrOrStderr = true
+	output := new(bytes.Buffer)
+	cli.RootCmd.SetErr(output)
+	require.Nil(t, cli.RootCmd.ParseFlags(nil))
+	require.Nil(t, cli.setupLogger())
+	cli.Logger.Info("visible message")
+	require.Contains(t, output.String(), "visible message")
+}
+
+func TestBotCli_setupLoggerCountsErrors(t *testing.T) {
+	t.Parallel()
+	cli := New("testbot")
+	cli.LogToErrOrStderr = true
+	cli.RootCmd.SetErr(new(bytes.Buffer))
+	require.Nil(t, cli.RootCmd.ParseFlags(nil))
+	require.Nil(t, cli.setupLogger())
+	logger := cli.GetLogger(2) // derived before the metrics server is started
+	logger.Error("failed")
+	logger.Info("ignored")
+	require.Equal(t, map[uint32]uint64{2: 1}, cli.metrics.errors.values)
+}
+
+func TestBotCli_MsgLogger(t *testing.T) {
+	t.Parallel()
+	cli := New("testbot")
+	core, logs := observer.New(zap.DebugLevel)
+	cli.Logger = zap.New(core).Sugar()
+	cli.MsgLogger(1, &deltachat.Message{ChatId: 10, Id: 20, FromId: 30}).Info("test")
+	require.Equal(t, 1, logs.Len())
+	require.Equal(t, map[string]any{"acc": uint32(1), "chat": uint32(10), "msg": uint32(20), "contact": uint32(30)}, logs.All()[0].ContextMap())
+}
+
+func TestBotCli_onLogLevelCmd(t *testing.T) {
+	t.Parallel()
+	cli := New("testbot")
+	var cliBot *deltachat.Bot
+	cli.OnBotInit(func(cli *BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string) {
+		cliBot = bot
+	})
+	go RunConfiguredCli(cli, "serve") //nolint:errcheck
+	for cliBot == nil || !cliBot.IsRunning() {
+	}
+	defer cliBot.Stop()
+
+	adminChatId, err := cli.AdminChat(cliBot, 1)
+	require.Nil(t, err)
+	qrdata, err := cliBot.Rpc.GetChatSecurejoinQrCode(1, &adminChatId)
+	require.Nil(t, err)
+
+	acfactory.WithOnlineAccount(func(rpc *deltachat.Rpc, accId uint32) {
+		chatId, err := rpc.SecureJoin(accId, qrdata)
+		require.Nil(t, err)
+		for {
+			event := acfactory.WaitForEvent(rpc, accId, &deltachat.EventTypeSecurejoinJoinerProgress{})
+			if event.(*deltachat.EventTypeSecurejoinJoinerProgress).Progress == 1000 {
+				break
+			}
+		}
+
+		_, err = rpc.MiscSendTextMessage(accId, chatId, "/loglevel warn")
+		require.Nil(t, err)
+		for {
+			msg := acfactory.NextMsg(rpc, accId)
+			if msg.FromId > deltachat.ContactLastSpecial && !msg.IsInfo {
+				require.Equal(t, "Log level set to warn", msg.Text)
+				break
+			}
+		}
+		require.Equal(t, zap.WarnLevel, cli.logLevel.Level())
+		value, err := cli.GetConfig(cliBot, 1, "log-level")
+		require.Nil(t, err)
+		require.Equal(t, "warn", *value)
+	})
+}
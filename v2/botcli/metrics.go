@@ -0,0 +1,263 @@
+package botcli
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/chatmail/rpc-client-go/v2/deltachat"
+	"go.uber.org/zap/zapcore"
+)
+
+// Upper bounds of the handler latency histogram buckets, in seconds.
+var latencyBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10}
+
+// RPC methods that send a message, used to count sent messages.
+var sendMethods = map[string]bool{
+	"send_msg":               true,
+	"send_sticker":           true,
+	"misc_send_text_message": true,
+	"misc_send_msg":          true,
+	"misc_send_draft":        true,
+}
+
+// Replacer of the characters that must be escaped in label values, see escapeLabel().
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// Counter of events per account.
+type counter struct {
+	mu     sync.Mutex
+	values map[uint32]uint64
+}
+
+func (c *counter) inc(accId uint32) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.values == nil {
+		c.values = make(map[uint32]uint64)
+	}
+	c.values[accId]++
+}
+
+func (c *counter) write(writer io.Writer, name string, help string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	fmt.Fprintf(writer, "# HELP %v %v\n", name, help)
+	fmt.Fprintf(writer, "# TYPE %v counter\n", name)
+	accounts := make([]uint32, 0, len(c.values))
+	for accId := range c.values {
+		accounts = append(accounts, accId)
+	}
+	sort.Slice(accounts, func(i, j int) bool { return accounts[i] < accounts[j] })
+	for _, accId := range accounts {
+		fmt.Fprintf(writer, "%v{account=\"%v\"} %v\n", name, accId, c.values[accId])
+	}
+}
+
+type histogram struct {
+	buckets []uint64
+	count   uint64
+	sum     float64
+}
+
+type handlerKey struct {
+	accId   uint32
+	handler string
+}
+
+// Metrics collected while the bot is serving, exposed in Prometheus text format by the serve --metrics-addr option.
+type metrics struct {
+	incomingMsgs counter
+	sentMsgs     counter
+	errors       counter
+	panics       counter
+	mu           sync.Mutex
+	latency      map[handlerKey]*histogram
+}
+
+func newMetrics() *metrics {
+	return &metrics{latency: make(map[handlerKey]*histogram)}
+}
+
+// Record how long the given handler took to process a message. It is safe to call it on a nil *metrics.
+func (m *metrics) observe(accId uint32, handler string, duration time.Duration) {
+	if m == nil {
+		return
+	}
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	key := handlerKey{accId, handler}
+	hist, ok := m.latency[key]
+	if !ok {
+		hist = &histogram{buckets: make([]uint64, len(latencyBuckets))}
+		m.latency[key] = hist
+	}
+	seconds := duration.Seconds()
+	for i, bound := range latencyBuckets {
+		if seconds <= bound {
+			hist.buckets[i]++
+		}
+	}
+	hist.count++
+	hist.sum += seconds
+}
+
+// Write the metrics in Prometheus text format, the state of the accounts is queried using the given bot.
+func (m *metrics) write(writer io.Writer, bot *deltachat.Bot) {
+	accounts, _ := bot.Rpc.GetAllAccountIds()
+	info, _ := bot.Rpc.GetSystemInfo()
+
+	m.incomingMsgs.write(writer, "deltabot_incoming_messages_total", "Number of incoming messages.")
+	m.sentMsgs.write(writer, "deltabot_sent_messages_total", "Number of messages sent by the bot.")
+	m.errors.write(writer, "deltabot_errors_total", "Number of errors logged while processing events and messages.")
+	m.panics.write(writer, "deltabot_panics_total", "Number of panics recovered in handlers.")
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	fmt.Fprintln(writer, "# HELP deltabot_handler_duration_seconds Time spent processing incoming messages.")
+	fmt.Fprintln(writer, "# TYPE deltabot_handler_duration_seconds histogram")
+	keys := make([]handlerKey, 0, len(m.latency))
+	for key := range m.latency {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i].accId != keys[j].accId {
+			return keys[i].accId < keys[j].accId
+		}
+		return keys[i].handler < keys[j].handler
+	})
+	for _, key := range keys {
+		hist := m.latency[key]
+		labels := fmt.Sprintf("account=\"%v\",handler=\"%v\"", key.accId, escapeLabel(key.handler))
+		for i, bound := range latencyBuckets {
+			le := strconv.FormatFloat(bound, 'f', -1, 64)
+			fmt.Fprintf(writer, "deltabot_handler_duration_seconds_bucket{%v,le=\"%v\"} %v\n", labels, le, hist.buckets[i])
+		}
+		fmt.Fprintf(writer, "deltabot_handler_duration_seconds_bucket{%v,le=\"+Inf\"} %v\n", labels, hist.count)
+		fmt.Fprintf(writer, "deltabot_handler_duration_seconds_sum{%v} %v\n", labels, hist.sum)
+		fmt.Fprintf(writer, "deltabot_handler_duration_seconds_count{%v} %v\n", labels, hist.count)
+	}
+
+	fmt.Fprintln(writer, "# HELP deltabot_account_configured Whether the account is configured (1) or not (0).")
+	fmt.Fprintln(writer, "# TYPE deltabot_account_configured gauge")
+	for _, accId := range accounts {
+		var value int
+		if isConf, _ := bot.Rpc.IsConfigured(accId); isConf {
+			value = 1
+		}
+		fmt.Fprintf(writer, "deltabot_account_configured{account=\"%v\"} %v\n", accId, value)
+	}
+
+	fmt.Fprintln(writer, "# HELP deltabot_core_info Version of the deltachat core used by the bot.")
+	fmt.Fprintln(writer, "# TYPE deltabot_core_info gauge")
+	fmt.Fprintf(writer, "deltabot_core_info{version=\"%v\"} 1\n", escapeLabel(info["deltachat_core_version"]))
+}
+
+// Escape the given label value as required by the Prometheus text format.
+func escapeLabel(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+// RpcTransport that counts incoming and sent messages.
+type metricsTransport struct {
+	deltachat.RpcTransport
+	metrics *metrics
+}
+
+func (trans *metricsTransport) Call(ctx context.Context, method string, params ...any) error {
+	err := trans.RpcTransport.Call(ctx, method, params...)
+	trans.countSent(method, err, params)
+	return err
+}
+
+func (trans *metricsTransport) CallResult(ctx context.Context, result any, method string, params ...any) error {
+	err := trans.RpcTransport.CallResult(ctx, result, method, params...)
+	trans.countSent(method, err, params)
+	if event, ok := result.(*deltachat.Event); ok && err == nil {
+		if _, ok := event.Event.(*deltachat.EventTypeIncomingMsg); ok {
+			trans.metrics.incomingMsgs.inc(event.ContextId)
+		}
+	}
+	return err
+}
+
+func (trans *metricsTransport) countSent(method string, err error, params []any) {
+	if err != nil || !sendMethods[method] || len(params) == 0 {
+		return
+	}
+	if accId, ok := params[0].(uint32); ok {
+		trans.metrics.sentMsgs.inc(accId)
+	}
+}
+
+// zapcore.Core that counts the logged errors of each account, the account is taken from the "acc" field.
+type errorCountingCore struct {
+	zapcore.Core
+	metrics *metrics
+	accId   uint32
+}
+
+func (core *errorCountingCore) With(fields []zapcore.Field) zapcore.Core {
+	accId := core.accId
+	for _, field := range fields {
+		if field.Key == "acc" && field.Type == zapcore.Uint32Type {
+			accId = uint32(field.Integer)
+		}
+	}
+	return &errorCountingCore{Core: core.Core.With(fields), metrics: core.metrics, accId: accId}
+}
+
+func (core *errorCountingCore) Check(entry zapcore.Entry, checked *zapcore.CheckedEntry) *zapcore.CheckedEntry {
+	if core.Enabled(entry.Level) {
+		return checked.AddCore(entry, core)
+	}
+	return checked
+}
+
+func (core *errorCountingCore) Write(entry zapcore.Entry, fields []zapcore.Field) error {
+	if entry.Level >= zapcore.ErrorLevel {
+		core.metrics.errors.inc(core.accId)
+	}
+	return core.Core.Write(entry, fields)
+}
+
+// Start counting the incoming and sent messages and serve the metrics over HTTP at the given address
+// until the returned function is called.
+func (botcli *BotCli) startMetrics(bot *deltachat.Bot, addr string) (func(), error) {
+	bot.Rpc.Transport = &metricsTransport{RpcTransport: bot.Rpc.Transport, metrics: botcli.metrics}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/metrics", func(writer http.ResponseWriter, request *http.Request) {
+		writer.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		botcli.metrics.write(writer, bot)
+	})
+	return botcli.serveHttp(addr, mux)
+}
+
+// Serve HTTP requests at the given address until the returned function is called.
+func (botcli *BotCli) serveHttp(addr string, handler http.Handler) (func(), error) {
+	server := &http.Server{Addr: addr, Handler: handler, ReadHeaderTimeout: 10 * time.Second}
+	listener, err := (&net.ListenConfig{}).Listen(context.Background(), "tcp", addr)
+	if err != nil {
+		return nil, err
+	}
+	botcli.Logger.Infof("Serving HTTP requests at %v", listener.Addr())
+	go func() {
+		if err := server.Serve(listener); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			botcli.Logger.Errorf("HTTP server failed: %v", err)
+		}
+	}()
+	return func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		_ = server.Shutdown(ctx)
+	}, nil
+}
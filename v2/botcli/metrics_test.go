@@ -0,0 +1,62 @@
+package botcli
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zapcore"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestCounter_Write(t *testing.T) {
+	t.Parallel()
+	var c counter
+	c.inc(2)
+	c.inc(1)
+	c.inc(2)
+	var out strings.Builder
+	c.write(&out, "test_total", "Test counter.")
+	expected := "# HELP test_total Test counter.\n# TYPE test_total counter\n" +
+		"test_total{account=\"1\"} 1\ntest_total{account=\"2\"} 2\n"
+	require.Equal(t, expected, out.String())
+}
+
+func TestMetrics_Observe(t *testing.T) {
+	t.Parallel()
+	var nilMetrics *metrics
+	nilMetrics.observe(1, "/help", time.Second)
+
+	m := newMetrics()
+	m.observe(1, "/help", 20*time.Millisecond)
+	m.observe(1, "/help", 3*time.Second)
+	hist := m.latency[handlerKey{1, "/help"}]
+	require.Equal(t, uint64(2), hist.count)
+	require.InDelta(t, 3.02, hist.sum, 0.0001)
+	require.Equal(t, uint64(0), hist.buckets[1])  // 0.01
+	require.Equal(t, uint64(1), hist.buckets[2])  // 0.025
+	require.Equal(t, uint64(2), hist.buckets[9])  // 5
+	require.Equal(t, uint64(2), hist.buckets[10]) // 10
+}
+
+func TestErrorCountingCore(t *testing.T) {
+	t.Parallel()
+	m := newMetrics()
+	core, logs := observer.New(zapcore.DebugLevel)
+	logger := zap.New(&errorCountingCore{Core: core, metrics: m}).Sugar()
+	logger.Error("no account")
+	logger.With("acc", uint32(3)).Error("first")
+	logger.With("acc", uint32(3)).Warn("ignored")
+	logger.With("acc", uint32(3)).With("chat", uint32(10)).Error("second")
+	require.Equal(t, map[uint32]uint64{0: 1, 3: 2}, m.errors.values)
+	require.Equal(t, 4, logs.Len())
+}
+
+func TestEscapeLabel(t *testing.T) {
+	t.Parallel()
+	require.Equal(t, "/café", escapeLabel("/café"))
+	require.Equal(t, `a\\b\"c\nd`, escapeLabel("a\\b\"c\nd"))
+	require.Equal(t, "nul\x00", escapeLabel("nul\x00"))
+}
@@ -0,0 +1,74 @@
+package botcli
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"github.com/spf13/cobra"
+)
+
+const (
+	// Human-readable output format of the built-in subcommands, selected with --output=text (default).
+	OutputText = "text"
+	// Machine-readable output format of the built-in subcommands, selected with --output=json.
+	OutputJson = "json"
+)
+
+// Output of a built-in subcommand for a single account.
+type accountOutput struct {
+	Id         uint32            `json:"id"`
+	Configured bool              `json:"configured"`
+	Addresses  []string          `json:"addresses,omitempty"`
+	InviteLink string            `json:"inviteLink,omitempty"`
+	Config     map[string]string `json:"config,omitempty"`
+	Roles      map[string]string `json:"roles,omitempty"`
+	Removed    bool              `json:"removed,omitempty"`
+	Backup     string            `json:"backup,omitempty"`
+	Relays     []relayOutput     `json:"relays,omitempty"`
+	Error      string            `json:"error,omitempty"`
+	// lines printed in text output format
+	text []string
+}
+
+// Call the given function for each account, collecting the outputs and errors of all accounts.
+func forEachAccount(accounts []uint32, callback func(out *accountOutput) error) ([]*accountOutput, error) {
+	outputs := make([]*accountOutput, 0, len(accounts))
+	var errs []error
+	for _, accId := range accounts {
+		out := &accountOutput{Id: accId}
+		if err := callback(out); err != nil {
+			out.Error = err.Error()
+			errs = append(errs, err)
+		}
+		outputs = append(outputs, out)
+	}
+	return outputs, errors.Join(errs...)
+}
+
+// Print the outputs to the output of the given command in the format selected with the --output option.
+// In text format, if header is true, the lines of each account are preceded by an "Account #<id>:" line.
+func printOutputs(cli *BotCli, cmd *cobra.Command, outputs []*accountOutput, header bool) error {
+	writer := cmd.OutOrStdout()
+	if cli.OutputFormat == OutputJson {
+		data, err := json.MarshalIndent(outputs, "", "  ")
+		if err != nil {
+			return err
+		}
+		fmt.Fprintln(writer, string(data))
+		return nil
+	}
+
+	for _, out := range outputs {
+		if header {
+			fmt.Fprintf(writer, "Account #%v:\n", out.Id)
+		}
+		for _, line := range out.text {
+			fmt.Fprintln(writer, line)
+		}
+		if header {
+			fmt.Fprintln(writer, "")
+		}
+	}
+	return nil
+}
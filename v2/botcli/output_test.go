@@ -0,0 +1,52 @@
+package botcli
+
+import (
+	"bytes"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+)
+
+func TestPrintOutputs(t *testing.T) {
+	t.Parallel()
+	outputs, err := forEachAccount([]uint32{1, 2}, func(out *accountOutput) error {
+		if out.Id == 2 {
+			return &AccountNotConfiguredErr{AccId: out.Id}
+		}
+		out.Configured = true
+		out.InviteLink = "https://i.delta.chat/#test"
+		out.text = append(out.text, out.InviteLink)
+		return nil
+	})
+	var notConfErr *AccountNotConfiguredErr
+	require.ErrorAs(t, err, &notConfErr)
+	require.Equal(t, uint32(2), notConfErr.AccId)
+
+	cli := New("testbot")
+	output := new(bytes.Buffer)
+	cli.RootCmd.SetOut(output)
+	cli.OutputFormat = OutputText
+	require.Nil(t, printOutputs(cli, cli.RootCmd, outputs, true))
+	require.Equal(t, "Account #1:\nhttps://i.delta.chat/#test\n\nAccount #2:\n\n", output.String())
+
+	output.Reset()
+	cli.OutputFormat = OutputJson
+	require.Nil(t, printOutputs(cli, cli.RootCmd, outputs, true))
+	var result []map[string]any
+	require.Nil(t, json.Unmarshal(output.Bytes(), &result))
+	require.Equal(t, []map[string]any{
+		{"id": 1.0, "configured": true, "inviteLink": "https://i.delta.chat/#test"},
+		{"id": 2.0, "configured": false, "error": "account #2 not configured"},
+	}, result)
+}
+
+func TestOutputFlag(t *testing.T) {
+	t.Parallel()
+	cli := New("testbot")
+	_, err := RunCli(cli, "--output=xml", "list")
+	require.NotNil(t, err)
+
+	_, err = RunConfiguredCli(cli, "--output=json", "list")
+	require.Nil(t, err)
+}
@@ -0,0 +1,57 @@
+package botcli
+
+import (
+	"fmt"
+	"runtime/debug"
+	"time"
+
+	"github.com/chatmail/rpc-client-go/v2/deltachat"
+	"go.uber.org/zap"
+)
+
+// Recover from a panic in the given handler so the bot keeps serving. The panic is logged with
+// its stack trace using the given logger and, if NotifyPanics is enabled, reported to the admin chat.
+//
+// It must be called with defer.
+func (botcli *BotCli) recoverHandler(bot *deltachat.Bot, accId uint32, logger *zap.SugaredLogger, handler string) {
+	value := recover()
+	if value == nil {
+		return
+	}
+	logger.Errorw(fmt.Sprintf("Recovered from panic in handler %v: %v", handler, value), "stack", string(debug.Stack()))
+	if botcli.metrics != nil {
+		botcli.metrics.panics.inc(accId)
+	}
+	if !botcli.NotifyPanics {
+		return
+	}
+	chatId, err := botcli.AdminChat(bot, accId)
+	if err == nil {
+		text := fmt.Sprintf("Recovered from panic in handler %v: %v", handler, value)
+		_, err = bot.Rpc.SendMsg(accId, chatId, deltachat.MessageData{Text: &text})
+	}
+	if err != nil {
+		logger.Errorf("Failed to report panic to the admin chat: %v", err)
+	}
+}
+
+// Run the given message handler, recovering from panics and measuring its latency.
+func (botcli *BotCli) runHandler(bot *deltachat.Bot, accId uint32, logger *zap.SugaredLogger, name string, handler func()) {
+	defer botcli.recoverHandler(bot, accId, logger, name)
+	start := time.Now()
+	handler()
+	botcli.metrics.observe(accId, name, time.Since(start))
+}
+
+// An EventHandler registered with BotCli.On() for the given event type.
+type eventHandler struct {
+	event   deltachat.EventType
+	handler deltachat.EventHandler
+}
+
+// Wrap the given EventHandler to recover from panics and measure its latency like runHandler().
+func (botcli *BotCli) wrapEventHandler(handler deltachat.EventHandler) deltachat.EventHandler {
+	return func(bot *deltachat.Bot, accId uint32, event deltachat.EventType) {
+		botcli.runHandler(bot, accId, botcli.GetLogger(accId), "event "+event.GetKind(), func() { handler(bot, accId, event) })
+	}
+}
@@ -0,0 +1,78 @@
+package botcli
+
+import (
+	"testing"
+
+	"github.com/chatmail/rpc-client-go/v2/deltachat"
+	"github.com/spf13/cobra"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+	"go.uber.org/zap/zaptest/observer"
+)
+
+func TestBotCli_runHandler(t *testing.T) {
+	t.Parallel()
+	cli := New("testbot")
+	cli.metrics = newMetrics()
+	core, logs := observer.New(zap.DebugLevel)
+	logger := zap.New(core).Sugar()
+
+	require.NotPanics(t, func() {
+		cli.runHandler(nil, 1, logger, "/crash", func() {
+			var msg *deltachat.Message
+			_ = msg.Text
+		})
+	})
+	require.Equal(t, 1, logs.Len())
+	require.Contains(t, logs.All()[0].Message, "Recovered from panic in handler /crash")
+	require.Contains(t, logs.All()[0].ContextMap()["stack"], "runHandler")
+	require.Equal(t, map[uint32]uint64{1: 1}, cli.metrics.panics.values)
+	require.Empty(t, cli.metrics.latency)
+
+	cli.runHandler(nil, 1, logger, "/ok", func() {})
+	require.Equal(t, 1, logs.Len())
+	require.Equal(t, uint64(1), cli.metrics.latency[handlerKey{1, "/ok"}].count)
+}
+
+func TestBotCli_NotifyPanics(t *testing.T) {
+	t.Parallel()
+	cli := New("testbot")
+	cli.NotifyPanics = true
+	var cliBot *deltachat.Bot
+	cli.OnBotInit(func(cli *BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string) {
+		cliBot = bot
+	})
+	cli.AddChatCommand("crash", "", func(cli *BotCli, bot *deltachat.Bot, req *ChatRequest) {
+		panic("boom")
+	})
+	cli.AddChatCommand("ping", "", func(cli *BotCli, bot *deltachat.Bot, req *ChatRequest) {
+		require.Nil(t, req.Reply(bot, "pong"))
+	})
+	go RunConfiguredCli(cli, "serve") //nolint:errcheck
+	for cliBot == nil || !cliBot.IsRunning() {
+	}
+	defer cliBot.Stop()
+
+	acfactory.WithOnlineAccount(func(rpc *deltachat.Rpc, accId uint32) {
+		chatWithBot := acfactory.CreateChat(rpc, accId, cliBot.Rpc, 1)
+
+		_, err := rpc.MiscSendTextMessage(accId, chatWithBot, "/crash")
+		require.Nil(t, err)
+		_, err = rpc.MiscSendTextMessage(accId, chatWithBot, "/ping")
+		require.Nil(t, err)
+		msg := acfactory.NextMsg(rpc, accId)
+		require.Equal(t, "pong", msg.Text)
+	})
+
+	adminChatId, err := cli.AdminChat(cliBot, 1)
+	require.Nil(t, err)
+	msgIds, err := cliBot.Rpc.GetMessageIds(1, adminChatId, false, false)
+	require.Nil(t, err)
+	var texts []string
+	for _, msgId := range msgIds {
+		msg, err := cliBot.Rpc.GetMessage(1, msgId)
+		require.Nil(t, err)
+		texts = append(texts, msg.Text)
+	}
+	require.Contains(t, texts, "Recovered from panic in handler /crash: boom")
+}
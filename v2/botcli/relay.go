@@ -0,0 +1,190 @@
+package botcli
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/chatmail/rpc-client-go/v2/deltachat"
+	"github.com/spf13/cobra"
+)
+
+// A relay of an account, as shown by the relay subcommands.
+type relayOutput struct {
+	Addr        string `json:"addr"`
+	Default     bool   `json:"default"`
+	Unpublished bool   `json:"unpublished"`
+}
+
+func initializeRelayCmd(cli *BotCli, relayCmd *cobra.Command) {
+	listCmd := &cobra.Command{
+		Use:   "list",
+		Short: "show the relays of the bot accounts",
+		Args:  cobra.ExactArgs(0),
+	}
+	cli.addSubcommandE(relayCmd, listCmd, relayListCallback)
+
+	addCmd := &cobra.Command{
+		Use:   "add",
+		Short: "add a relay to the selected account. If only one argument is given it must be a configuration URI (ex. dcaccount:), otherwise an address and a password",
+		Args:  cobra.RangeArgs(1, 2),
+	}
+	cli.addSubcommandE(relayCmd, addCmd, relayAddCallback)
+
+	removeCmd := &cobra.Command{
+		Use:   "remove",
+		Short: "remove the relay with the given address, the default relay can't be removed",
+		Args:  cobra.ExactArgs(1),
+	}
+	cli.addSubcommandE(relayCmd, removeCmd, relayRemoveCallback)
+
+	setDefaultCmd := &cobra.Command{
+		Use:   "set-default",
+		Short: "use the relay with the given address as the default relay of its account",
+		Args:  cobra.ExactArgs(1),
+	}
+	cli.addSubcommandE(relayCmd, setDefaultCmd, relaySetDefaultCallback)
+}
+
+func relayListCallback(cli *BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string) error {
+	accounts, err := selectedAccounts(cli, bot)
+	if err != nil {
+		return err
+	}
+
+	outputs, err := forEachAccount(accounts, func(out *accountOutput) error {
+		return relaysForAcc(bot, out)
+	})
+	return errors.Join(printOutputs(cli, cmd, outputs, true), err)
+}
+
+func relayAddCallback(cli *BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string) error {
+	accId, err := singleAccount(cli, bot)
+	if err != nil {
+		return err
+	}
+	if err := addRelay(cli, bot, accId, args); err != nil {
+		return fmt.Errorf("failed to add relay: %w", err)
+	}
+	cli.GetLogger(accId).Info("Relay added successfully.")
+
+	outputs, err := forEachAccount([]uint32{accId}, func(out *accountOutput) error {
+		return relaysForAcc(bot, out)
+	})
+	return errors.Join(printOutputs(cli, cmd, outputs, true), err)
+}
+
+func relayRemoveCallback(cli *BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string) error {
+	accId, err := relayAccount(cli, bot, args[0])
+	if err != nil {
+		return err
+	}
+	if err := bot.Rpc.DeleteTransport(accId, args[0]); err != nil {
+		return fmt.Errorf("failed to remove relay: %w", err)
+	}
+	cli.GetLogger(accId).Infof("Relay %v removed successfully.", args[0])
+
+	outputs, err := forEachAccount([]uint32{accId}, func(out *accountOutput) error {
+		return relaysForAcc(bot, out)
+	})
+	return errors.Join(printOutputs(cli, cmd, outputs, true), err)
+}
+
+func relaySetDefaultCallback(cli *BotCli, bot *deltachat.Bot, cmd *cobra.Command, args []string) error {
+	accId, err := relayAccount(cli, bot, args[0])
+	if err != nil {
+		return err
+	}
+	if err := bot.Rpc.SetConfig(accId, "configured_addr", &args[0]); err != nil {
+		return fmt.Errorf("failed to set default relay: %w", err)
+	}
+	cli.GetLogger(accId).Infof("Default relay set to %v.", args[0])
+
+	outputs, err := forEachAccount([]uint32{accId}, func(out *accountOutput) error {
+		return relaysForAcc(bot, out)
+	})
+	return errors.Join(printOutputs(cli, cmd, outputs, true), err)
+}
+
+func relaysForAcc(bot *deltachat.Bot, out *accountOutput) error {
+	out.Configured, _ = bot.Rpc.IsConfigured(out.Id)
+	relays, err := bot.Rpc.ListTransportsEx(out.Id)
+	if err != nil {
+		return err
+	}
+	defAddr, err := bot.Rpc.GetConfig(out.Id, "configured_addr")
+	if err != nil {
+		return err
+	}
+
+	out.Relays = make([]relayOutput, 0, len(relays))
+	for _, relay := range relays {
+		relayOut := relayOutput{Addr: relay.Param.Addr, Unpublished: relay.IsUnpublished}
+		relayOut.Default = defAddr != nil && strings.EqualFold(*defAddr, relay.Param.Addr)
+		out.Relays = append(out.Relays, relayOut)
+
+		var tags []string
+		if relayOut.Default {
+			tags = append(tags, "default")
+		}
+		if relayOut.Unpublished {
+			tags = append(tags, "unpublished")
+		}
+		line := relayOut.Addr
+		if len(tags) != 0 {
+			line += " (" + strings.Join(tags, ", ") + ")"
+		}
+		out.text = append(out.text, line)
+	}
+	if len(relays) == 0 {
+		out.text = append(out.text, "(not configured)")
+	}
+	return nil
+}
+
+// Add the relay given in the command line arguments to the given account, the arguments are either
+// a configuration URI or an address and a password. The configuration progress is logged.
+func addRelay(cli *BotCli, bot *deltachat.Bot, accId uint32, args []string) error {
+	bot.On(&deltachat.EventTypeConfigureProgress{}, func(bot *deltachat.Bot, accId uint32, event deltachat.EventType) {
+		ev := event.(*deltachat.EventTypeConfigureProgress)
+		if ev.Comment != nil && *ev.Comment != "" {
+			cli.GetLogger(accId).Infof("Configuration progress: %v (%v)", ev.Progress, *ev.Comment)
+		} else {
+			cli.GetLogger(accId).Infof("Configuration progress: %v", ev.Progress)
+		}
+	})
+
+	// the bot needs to be running to process the configuration events
+	errChan := make(chan error, 1)
+	go func() {
+		if len(args) == 2 {
+			params := deltachat.EnteredLoginParam{Addr: args[0], Password: args[1]}
+			errChan <- bot.Rpc.AddOrUpdateTransport(accId, params)
+		} else {
+			errChan <- bot.Rpc.AddTransportFromQr(accId, args[0])
+		}
+		bot.Stop()
+	}()
+	bot.Run() //nolint:errcheck
+	return <-errChan
+}
+
+// Get the account selected with the -a/--account option, or the only account of the bot.
+func singleAccount(cli *BotCli, bot *deltachat.Bot) (uint32, error) {
+	accounts, err := selectedAccounts(cli, bot)
+	if err != nil {
+		return 0, err
+	}
+	if len(accounts) > 1 {
+		return 0, errors.New("there are more than one account, select one with the -a/--account option")
+	}
+	return accounts[0], nil
+}
+
+// Get the account selected with the -a/--account option, or the account that has the relay with the given address.
+func relayAccount(cli *BotCli, bot *deltachat.Bot, addr string) (uint32, error) {
+	if cli.SelectedAccount != 0 {
+		return cli.SelectedAccount, nil
+	}
+	return cli.ResolveAccount(bot, addr)
+}
@@ -0,0 +1,38 @@
+package botcli_test
+
+import (
+	"testing"
+
+	"github.com/deltachat-bot/deltabot-cli-go/v2/botcli"
+	"github.com/deltachat-bot/deltabot-cli-go/v2/botcli/bottest"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRelay(t *testing.T) {
+	t.Parallel()
+	fake := bottest.New()
+	fake.AddAccount("bot@example.org")
+
+	result := runFake(t, fake, "relay", "add", "dclogin:bot@other.org?p=secret")
+	require.Nil(t, result.Err)
+	require.Contains(t, result.Log, "Configuration progress: 1000")
+	require.Contains(t, result.Stdout, "bot@example.org (default)\nbot@other.org\n")
+
+	result = runFake(t, fake, "relay", "set-default", "bot@other.org")
+	require.Nil(t, result.Err)
+	result = runFake(t, fake, "relay", "list")
+	require.Nil(t, result.Err)
+	require.Equal(t, "Account #1:\nbot@other.org (default)\nbot@example.org\n\n", result.Stdout)
+
+	result = runFake(t, fake, "relay", "remove", "bot@other.org")
+	require.NotNil(t, result.Err)
+	result = runFake(t, fake, "relay", "remove", "bot@example.org")
+	require.Nil(t, result.Err)
+	relays, err := fake.Rpc().ListTransports(1)
+	require.Nil(t, err)
+	require.Len(t, relays, 1)
+	require.Equal(t, "bot@other.org", relays[0].Addr)
+
+	result = runFake(t, fake, "relay", "remove", "unknown@example.org")
+	require.ErrorAs(t, result.Err, new(*botcli.AccountNotFoundErr))
+}
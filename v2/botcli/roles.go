@@ -0,0 +1,134 @@
+package botcli
+
+import (
+	"sort"
+	"strconv"
+
+	"github.com/chatmail/rpc-client-go/v2/deltachat"
+)
+
+const (
+	// Role of commands that anybody can use.
+	RolePublic = ""
+	// Role of the bot administrators, see AdminChat().
+	RoleAdmin = "admin"
+)
+
+// A function that checks whether a contact has a custom role, see AddRole().
+type RoleChecker func(cli *BotCli, bot *deltachat.Bot, accId uint32, contactId uint32) (bool, error)
+
+// Register a custom role. The given checker will be used to decide if a contact has the role,
+// if checker is nil, the members of the role's group (see RoleChat()) have the role.
+func (botcli *BotCli) AddRole(role string, checker RoleChecker) {
+	if role == RolePublic || role == RoleAdmin {
+		panic("Can not override built-in role: " + role)
+	}
+	botcli.roles[role] = checker
+}
+
+// Get the roles backed by a group chat, the RoleAdmin role is always included.
+func (botcli *BotCli) ChatRoles() []string {
+	roles := []string{RoleAdmin}
+	for role, checker := range botcli.roles {
+		if checker == nil {
+			roles = append(roles, role)
+		}
+	}
+	sort.Strings(roles[1:])
+	return roles
+}
+
+// Returns true if contact has the given role, false otherwise.
+// Every contact has the RolePublic role, only bot administrators have the RoleAdmin role.
+func (botcli *BotCli) HasRole(bot *deltachat.Bot, accId uint32, contactId uint32, role string) (bool, error) {
+	if role == RolePublic {
+		return true, nil
+	}
+	checker, ok := botcli.roles[role]
+	if !ok && role != RoleAdmin {
+		return false, &RoleNotFoundErr{Role: role}
+	}
+	if checker != nil {
+		return checker(botcli, bot, accId, contactId)
+	}
+
+	chatId, err := botcli.RoleChat(bot, accId, role)
+	if err != nil {
+		return false, err
+	}
+	contacts, err := bot.Rpc.GetChatContacts(accId, chatId)
+	if err != nil {
+		return false, err
+	}
+	for _, memberId := range contacts {
+		if contactId == memberId {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// Get the group of the given role, all members of the group have the role.
+func (botcli *BotCli) RoleChat(bot *deltachat.Bot, accId uint32, role string) (uint32, error) {
+	if isConf, _ := bot.Rpc.IsConfigured(accId); !isConf {
+		return 0, &BotNotConfiguredErr{}
+	}
+
+	value, err := botcli.GetConfig(bot, accId, role+"-chat")
+	if err != nil {
+		return 0, err
+	}
+
+	var chatId uint32
+
+	if value != nil {
+		chatIdInt, err := strconv.ParseUint(*value, 10, 0)
+		if err != nil {
+			return 0, err
+		}
+		chatId = uint32(chatIdInt)
+		selfInGroup, err := bot.Rpc.CanSend(accId, chatId)
+		if err != nil {
+			return 0, err
+		}
+		if !selfInGroup {
+			value = nil
+		}
+	}
+
+	if value == nil {
+		chatId, err = botcli.ResetRoleChat(bot, accId, role)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return chatId, nil
+}
+
+// Reset the group of the given role, all the members of the old group no longer have the role.
+func (botcli *BotCli) ResetRoleChat(bot *deltachat.Bot, accId uint32, role string) (uint32, error) {
+	if isConf, _ := bot.Rpc.IsConfigured(accId); !isConf {
+		return 0, &BotNotConfiguredErr{}
+	}
+
+	chatId, err := bot.Rpc.CreateGroupChat(accId, roleChatName(role), false)
+	if err != nil {
+		return 0, err
+	}
+	value := strconv.FormatUint(uint64(chatId), 10)
+	err = botcli.SetConfig(bot, accId, role+"-chat", &value)
+	if err != nil {
+		return 0, err
+	}
+
+	return chatId, nil
+}
+
+func roleChatName(role string) string {
+	if role == RoleAdmin {
+		return "Bot Administrators"
+	}
+	return "Bot Role: " + role
+}
@@ -0,0 +1,56 @@
+package botcli_test
+
+import (
+	"testing"
+	"time"
+
+	"github.com/chatmail/rpc-client-go/v2/deltachat"
+	"github.com/deltachat-bot/deltabot-cli-go/v2/botcli"
+	"github.com/deltachat-bot/deltabot-cli-go/v2/botcli/bottest"
+	"github.com/stretchr/testify/require"
+	"go.uber.org/zap"
+)
+
+func TestOnNewMsgRouter_OnlyBuiltinCommands(t *testing.T) {
+	t.Parallel()
+	fake := bottest.New()
+	accId := fake.AddAccount("bot@example.org")
+	cli := newFakeCli(fake)
+	cli.OnNewMsg(func(cli *botcli.BotCli, bot *deltachat.Bot, accId uint32, msg *deltachat.Message, logger *zap.SugaredLogger) {
+		_, err := bot.Rpc.MiscSendTextMessage(accId, msg.ChatId, "got "+msg.Text)
+		require.Nil(t, err)
+	})
+	serveFake(t, cli, fake)
+
+	for _, text := range []string{"/start", "hello"} {
+		fake.ReceiveText(accId, "alice@example.org", text)
+		msg, err := fake.NextSentMsg(accId, time.Second)
+		require.Nil(t, err)
+		require.Equal(t, "got "+text, msg.Text)
+	}
+}
+
+func TestLogLevelCommand(t *testing.T) {
+	t.Parallel()
+	fake := bottest.New()
+	accId := fake.AddAccount("bot@example.org")
+	cli := newFakeCli(fake)
+	serveFake(t, cli, fake)
+
+	adminChatId, err := cli.AdminChat(deltachat.NewBot(fake.Rpc()), accId)
+	require.Nil(t, err)
+	aliceId := fake.AddContact(accId, "alice@example.org", "")
+	require.Nil(t, fake.Rpc().AddContactToChat(accId, adminChatId, aliceId))
+
+	fake.ReceiveText(accId, "alice@example.org", "/loglevel debug")
+	msg, err := fake.NextSentMsg(accId, time.Second)
+	require.Nil(t, err)
+	require.Equal(t, "The /loglevel command can only be used in the bot administrators group", msg.Text)
+
+	text := "/loglevel debug"
+	fake.ReceiveMsg(accId, adminChatId, aliceId, deltachat.MessageData{Text: &text})
+	msg, err = fake.NextSentMsg(accId, time.Second)
+	require.Nil(t, err)
+	require.Equal(t, adminChatId, msg.ChatId)
+	require.Equal(t, "Log level set to debug", msg.Text)
+}
@@ -0,0 +1,193 @@
+package botcli
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strings"
+	"sync"
+
+	"github.com/chatmail/rpc-client-go/v2/deltachat"
+	"github.com/creachadair/jrpc2"
+	"github.com/creachadair/jrpc2/channel"
+)
+
+// An RPC transport that needs to be opened before use and closed when the program exits, ex. *deltachat.IOTransport.
+type Transport interface {
+	deltachat.RpcTransport
+	// Open connects to the RPC server, starting it if needed.
+	Open() error
+	// Close disconnects from the RPC server, stopping it if it was started by Open().
+	Close()
+}
+
+// A function that can be used as BotCli.TransportFactory.
+type TransportFactory func(cli *BotCli) (Transport, error)
+
+// SocketTransport is a Delta Chat RPC transport connecting to an already running RPC server
+// over a Unix domain socket or TCP, ex. a deltachat-rpc-server exposed with socat.
+type SocketTransport struct {
+	// Network is "unix" or "tcp"
+	Network string
+	Address string
+	conn    net.Conn
+	client  *jrpc2.Client
+	mu      sync.Mutex
+}
+
+// Open connects to the RPC server.
+func (trans *SocketTransport) Open() error {
+	trans.mu.Lock()
+	defer trans.mu.Unlock()
+
+	if trans.conn != nil {
+		return &deltachat.TransportStartedErr{}
+	}
+	conn, err := (&net.Dialer{}).DialContext(context.Background(), trans.Network, trans.Address)
+	if err != nil {
+		return err
+	}
+	trans.conn = conn
+	trans.client = jrpc2.NewClient(channel.Line(conn, conn), nil)
+	return nil
+}
+
+// Close disconnects from the RPC server, the server keeps running.
+func (trans *SocketTransport) Close() {
+	trans.mu.Lock()
+	defer trans.mu.Unlock()
+
+	if trans.conn == nil {
+		return
+	}
+	_ = trans.client.Close()
+	trans.conn = nil
+}
+
+// Call requests the RPC server to call a function that does not have a return value.
+func (trans *SocketTransport) Call(ctx context.Context, method string, params ...any) error {
+	_, err := trans.client.Call(ctx, method, params)
+	return err
+}
+
+// CallResult requests the RPC server to call a function that does have a return value.
+func (trans *SocketTransport) CallResult(ctx context.Context, result any, method string, params ...any) error {
+	return trans.client.CallResult(ctx, method, params, &result)
+}
+
+// ProcessTransport is a Delta Chat RPC transport using a deltachat-rpc-server process started by Open(),
+// like *deltachat.IOTransport but allowing to set extra environment variables for the server process.
+//
+// Open(), Close() and the Call methods are copied from deltachat.IOTransport (io_transport.go in
+// github.com/chatmail/rpc-client-go) instead of wrapping it, because IOTransport creates the server's
+// exec.Cmd inside Open() and overwrites its environment, so there is no way to pass extra variables.
+// Keep them in sync with upstream.
+type ProcessTransport struct {
+	// Cmd is the deltachat-rpc-server executable to run
+	Cmd         string
+	AccountsDir string
+	// Env are extra environment variables in the form KEY=VALUE for the server process,
+	// the server process also inherits the environment of the bot
+	Env    []string
+	Stderr io.Writer
+	cmd    *exec.Cmd
+	stdin  io.WriteCloser
+	client *jrpc2.Client
+	cancel context.CancelFunc
+	mu     sync.Mutex
+}
+
+// Open starts the deltachat-rpc-server process and connects to it.
+func (trans *ProcessTransport) Open() error {
+	trans.mu.Lock()
+	defer trans.mu.Unlock()
+
+	if trans.cmd != nil {
+		return &deltachat.TransportStartedErr{}
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	cmd := exec.CommandContext(ctx, trans.Cmd)
+	cmd.Env = append(os.Environ(), trans.Env...)
+	if trans.AccountsDir != "" {
+		cmd.Env = append(cmd.Env, "DC_ACCOUNTS_PATH="+trans.AccountsDir)
+	}
+	cmd.Stderr = trans.Stderr
+	stdin, err := cmd.StdinPipe()
+	if err != nil {
+		cancel()
+		return err
+	}
+	stdout, err := cmd.StdoutPipe()
+	if err != nil {
+		cancel()
+		return err
+	}
+	if err := cmd.Start(); err != nil {
+		cancel()
+		return err
+	}
+	trans.cmd = cmd
+	trans.cancel = cancel
+	trans.stdin = stdin
+	trans.client = jrpc2.NewClient(channel.Line(stdout, stdin), nil)
+	return nil
+}
+
+// Close stops the deltachat-rpc-server process.
+func (trans *ProcessTransport) Close() {
+	trans.mu.Lock()
+	defer trans.mu.Unlock()
+
+	if trans.cmd == nil {
+		return
+	}
+	_ = trans.stdin.Close()
+	trans.cancel()
+	trans.cmd.Wait() //nolint:errcheck
+	trans.cmd = nil
+}
+
+// Call requests the RPC server to call a function that does not have a return value.
+func (trans *ProcessTransport) Call(ctx context.Context, method string, params ...any) error {
+	_, err := trans.client.Call(ctx, method, params)
+	return err
+}
+
+// CallResult requests the RPC server to call a function that does have a return value.
+func (trans *ProcessTransport) CallResult(ctx context.Context, result any, method string, params ...any) error {
+	return trans.client.CallResult(ctx, method, params, &result)
+}
+
+// Parse the value of the --rpc-socket option in the form unix:PATH or tcp:HOST:PORT.
+func parseRpcSocket(value string) (*SocketTransport, error) {
+	network, address, _ := strings.Cut(value, ":")
+	if (network != "unix" && network != "tcp") || address == "" {
+		return nil, fmt.Errorf("invalid RPC socket %q, expected unix:PATH or tcp:HOST:PORT", value)
+	}
+	return &SocketTransport{Network: network, Address: address}, nil
+}
+
+// Create the transport used to communicate with the RPC server.
+func (botcli *BotCli) newTransport() (Transport, error) {
+	if botcli.TransportFactory != nil {
+		return botcli.TransportFactory(botcli)
+	}
+	if botcli.RpcSocket != "" {
+		return parseRpcSocket(botcli.RpcSocket)
+	}
+
+	for _, variable := range botcli.RpcServerEnv {
+		if key, _, ok := strings.Cut(variable, "="); !ok || key == "" {
+			return nil, fmt.Errorf("invalid RPC server environment variable %q, expected KEY=VALUE", variable)
+		}
+	}
+	return &ProcessTransport{
+		Cmd:         botcli.RpcServerPath,
+		AccountsDir: getAccountsDir(botcli.AppDir),
+		Env:         botcli.RpcServerEnv,
+		Stderr:      os.Stderr,
+	}, nil
+}
@@ -0,0 +1,103 @@
+package botcli
+
+import (
+	"context"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/chatmail/rpc-client-go/v2/deltachat"
+	"github.com/creachadair/jrpc2"
+	"github.com/creachadair/jrpc2/channel"
+	"github.com/creachadair/jrpc2/handler"
+	"github.com/stretchr/testify/require"
+)
+
+// Start a minimal RPC server without accounts listening at the given address.
+func listenRpc(t *testing.T, network string, address string) net.Listener {
+	listener, err := net.Listen(network, address)
+	require.Nil(t, err)
+	t.Cleanup(func() { listener.Close() })
+	methods := handler.Map{
+		"get_system_info": handler.New(func(ctx context.Context) (map[string]string, error) {
+			return map[string]string{"deltachat_core_version": CoreVersion}, nil
+		}),
+		"get_all_account_ids": handler.New(func(ctx context.Context) ([]uint32, error) {
+			return []uint32{}, nil
+		}),
+	}
+	go func() {
+		for {
+			conn, err := listener.Accept()
+			if err != nil {
+				return
+			}
+			jrpc2.NewServer(methods, nil).Start(channel.Line(conn, conn))
+		}
+	}()
+	return listener
+}
+
+func TestParseRpcSocket(t *testing.T) {
+	t.Parallel()
+	trans, err := parseRpcSocket("unix:/run/bot/rpc.sock")
+	require.Nil(t, err)
+	require.Equal(t, "unix", trans.Network)
+	require.Equal(t, "/run/bot/rpc.sock", trans.Address)
+
+	trans, err = parseRpcSocket("tcp:127.0.0.1:4000")
+	require.Nil(t, err)
+	require.Equal(t, "tcp", trans.Network)
+	require.Equal(t, "127.0.0.1:4000", trans.Address)
+
+	_, err = parseRpcSocket("/run/bot/rpc.sock")
+	require.NotNil(t, err)
+	_, err = parseRpcSocket("tcp:")
+	require.NotNil(t, err)
+}
+
+func TestBotCli_RpcSocket(t *testing.T) {
+	t.Parallel()
+	socket := filepath.Join(t.TempDir(), "rpc.sock")
+	listenRpc(t, "unix", socket)
+	_, err := RunCli(New("testbot"), "--rpc-socket=unix:"+socket, "list")
+	require.Nil(t, err)
+}
+
+func TestBotCli_TransportFactory(t *testing.T) {
+	t.Parallel()
+	listener := listenRpc(t, "tcp", "127.0.0.1:0")
+	cli := New("testbot")
+	cli.TransportFactory = func(cli *BotCli) (Transport, error) {
+		return &SocketTransport{Network: "tcp", Address: listener.Addr().String()}, nil
+	}
+	_, err := RunCli(cli, "list")
+	require.Nil(t, err)
+}
+
+func TestProcessTransport(t *testing.T) {
+	t.Parallel()
+	dir := t.TempDir()
+	envFile := filepath.Join(dir, "env")
+	script := filepath.Join(dir, "rpc-server")
+	require.Nil(t, os.WriteFile(script, []byte("#!/bin/sh\nenv > "+envFile+"\ncat > /dev/null\n"), 0700))
+
+	trans := &ProcessTransport{Cmd: script, AccountsDir: dir, Env: []string{"TESTBOT_SERVER_VAR=1"}}
+	require.Nil(t, trans.Open())
+	require.IsType(t, &deltachat.TransportStartedErr{}, trans.Open())
+	require.Eventually(t, func() bool {
+		data, _ := os.ReadFile(envFile)
+		return strings.Contains(string(data), "DC_ACCOUNTS_PATH="+dir+"\n")
+	}, time.Second, time.Millisecond)
+	trans.Close()
+	trans.Close()
+
+	data, err := os.ReadFile(envFile)
+	require.Nil(t, err)
+	require.Contains(t, string(data), "TESTBOT_SERVER_VAR=1\n")
+	_, ok := os.LookupEnv("TESTBOT_SERVER_VAR")
+	require.False(t, ok)
+}
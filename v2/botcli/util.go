@@ -3,6 +3,8 @@ package botcli
 import (
 	"os"
 	"path/filepath"
+	"strings"
+	"unicode"
 )
 
 func getDefaultAppDir(appName string) string {
@@ -13,3 +15,14 @@ func getDefaultAppDir(appName string) string {
 func getAccountsDir(appDir string) string {
 	return filepath.Join(appDir, "accounts")
 }
+
+// Get the prefix of the environment variables of the given program, ex. "MY_BOT_" for "my-bot".
+func getEnvPrefix(appName string) string {
+	prefix := strings.Map(func(char rune) rune {
+		if unicode.IsLetter(char) || unicode.IsDigit(char) {
+			return unicode.ToUpper(char)
+		}
+		return '_'
+	}, appName)
+	return prefix + "_"
+}